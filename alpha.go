@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/BurntSushi/xgbutil/xgraphics"
+)
+
+// alphaModes is the list of ways that the alpha channel of an image can be
+// shown, in the order that the cycle-alpha-mode action goes through them.
+//
+//	normal: the image is blended into the backdrop.
+//	alpha: the alpha channel alone, as grayscale. (Opaque is white.)
+//	tint: like normal, but fully transparent pixels are tinted.
+//	straight: the color channels without alpha (i.e., not premultiplied).
+//	premultiplied: the color channels multiplied by alpha.
+var alphaModes = []string{
+	"normal", "alpha", "tint", "straight", "premultiplied",
+}
+
+// tintColor is drawn over fully transparent pixels in the "tint" mode.
+var tintColor = xgraphics.BGRA{B: 0xff, G: 0x00, R: 0xff, A: 0xa0}
+
+// render describes how a decoded image is converted for display: the
+// backdrop that transparent pixels are blended into, and the alpha mode.
+type render struct {
+	backdrop string
+	alpha    string
+}
+
+// hasAlpha returns true if any pixel in img isn't fully opaque. Most image
+// types can answer this themselves (i.e., *image.YCbCr is always opaque),
+// but other images have to be scanned.
+func hasAlpha(img image.Image) bool {
+	if o, ok := img.(interface {
+		Opaque() bool
+	}); ok {
+		return !o.Opaque()
+	}
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// showAlpha draws the alpha channel of the decoded image img into dest (the
+// converted image) according to the alpha mode in rend. The pixels are read
+// from img, since the conversion doesn't keep straight colors around.
+func showAlpha(dest *xgraphics.Image, img image.Image, rend render) {
+	if rend.alpha == "tint" {
+		blendBackdrop(dest, rend.backdrop)
+	}
+
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.At(x, y)
+			nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+
+			switch rend.alpha {
+			case "alpha":
+				dest.SetBGRA(x, y, xgraphics.BGRA{
+					B: nrgba.A, G: nrgba.A, R: nrgba.A, A: 0xff,
+				})
+			case "tint":
+				if nrgba.A == 0 {
+					bgra := dest.At(x, y).(xgraphics.BGRA)
+					dest.SetBGRA(x, y, xgraphics.BlendBGRA(bgra, tintColor))
+				}
+			case "straight":
+				dest.SetBGRA(x, y, xgraphics.BGRA{
+					B: nrgba.B, G: nrgba.G, R: nrgba.R, A: 0xff,
+				})
+			case "premultiplied":
+				cr, cg, cb, _ := c.RGBA()
+				dest.SetBGRA(x, y, xgraphics.BGRA{
+					B: uint8(cb >> 8), G: uint8(cg >> 8), R: uint8(cr >> 8),
+					A: 0xff,
+				})
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"image"
+	"time"
 
 	"github.com/BurntSushi/xgbutil"
 	"github.com/BurntSushi/xgbutil/xgraphics"
@@ -20,6 +21,10 @@ type chans struct {
 	// and paints the image generated by that origin.
 	drawChan chan func(pt image.Point) image.Point
 
+	// geomChan, when pinged, tells the canvas that the size of the window
+	// (or its background) has changed, and everything must be repainted.
+	geomChan chan struct{}
+
 	// resizeToImageChan, when pinged, will resize the window to fit the
 	// current image exactly.
 	resizeToImageChan chan struct{}
@@ -30,10 +35,153 @@ type chans struct {
 	// nextImg can be pinged to cycle to the next image. It wraps.
 	nextImg chan struct{}
 
+	// resizeEachChan, when pinged, toggles whether the window is resized to
+	// every image shown.
+	resizeEachChan chan struct{}
+
+	// stepChan is sent a direction (i.e., (-1, 0) for left) to pan the
+	// image by flagStepIncrement pixels, or to move the selection in the
+	// thumbnail grid.
+	stepChan chan image.Point
+
+	// thumbChan is sent values whenever a thumbnail has been generated.
+	thumbChan chan thumbLoaded
+
+	// gridChan, when pinged, toggles the thumbnail grid.
+	gridChan chan struct{}
+
+	// openChan, when pinged, shows the image selected in the thumbnail grid.
+	openChan chan struct{}
+
+	// stripChan, when pinged, toggles the filmstrip.
+	stripChan chan struct{}
+
+	// infoChan, when pinged, toggles the information overlay.
+	infoChan chan struct{}
+
+	// inspectChan, when pinged, toggles the pixel inspector.
+	inspectChan chan struct{}
+
+	// pointerChan is sent the position of the pointer whenever it moves
+	// while the pixel inspector is active.
+	pointerChan chan image.Point
+
+	// copyChan, when pinged, copies the color of the inspected pixel to the
+	// clipboard.
+	copyChan chan struct{}
+
+	// histChan, when pinged, toggles the histogram panel.
+	histChan chan struct{}
+
+	// histRegionChan, when pinged, toggles whether the histogram describes
+	// the whole image or only the visible part of it.
+	histRegionChan chan struct{}
+
+	// histLoadedChan is sent histograms when they have been computed.
+	histLoadedChan chan *histogram
+
+	// backdropChan, when pinged, switches to the next backdrop that
+	// transparent images are blended into.
+	backdropChan chan struct{}
+
+	// alphaChan, when pinged, switches to the next alpha mode.
+	alphaChan chan struct{}
+
+	// compareChan, when pinged, toggles the comparison mode.
+	compareChan chan struct{}
+
+	// compareLayoutChan, when pinged, switches the comparison mode between
+	// showing the images side by side and stacked.
+	compareLayoutChan chan struct{}
+
+	// swapChan, when pinged, swaps the images being compared.
+	swapChan chan struct{}
+
+	// compareModeChan, when pinged, switches to the next comparison mode.
+	compareModeChan chan struct{}
+
+	// flipChan, when pinged, switches between images A and B in the flicker
+	// comparison mode.
+	flipChan chan struct{}
+
+	// holdChan is sent true when a key bound to flip-compare is pressed and
+	// false when it's released, so that image B is shown in the flicker
+	// comparison mode while the key is held down.
+	holdChan chan bool
+
+	// autoFlipChan, when pinged, toggles switching between images A and B
+	// on a timer in the flicker comparison mode.
+	autoFlipChan chan struct{}
+
+	// diffChan is sent differences between images when they have been
+	// computed.
+	diffChan chan *difference
+
+	// fitChan is sent images that have been scaled down to fit in the work
+	// area. (See fitImage.)
+	fitChan chan fitted
+
+	// opacityChan is sent the amount (in percent) to change the opacity of
+	// image B by in the onion comparison mode.
+	opacityChan chan int
+
+	// addChan is sent images to add to the end of the list.
+	addChan chan added
+
+	// gotoChan is sent the index of an image to show.
+	gotoChan chan int
+
+	// shownChan is sent a channel that the canvas sends a description of
+	// the current image on.
+	shownChan chan chan shown
+
+	// commandChan is sent shell command lines to run on the current image.
+	commandChan chan string
+
+	// reloadChan is sent images that have been opened again, since a
+	// command changed their files.
+	reloadChan chan reloaded
+
+	// fileChan is sent operations on the file of the current image.
+	fileChan chan fileOp
+
+	// fileDoneChan is sent the results of file operations.
+	fileDoneChan chan fileDone
+
+	// renameChan, when pinged, opens a prompt for a new name for the file of
+	// the current image.
+	renameChan chan struct{}
+
+	// renamedChan is sent the new names entered in the prompt.
+	renamedChan chan renamed
+
+	// markChan is sent how to change which images are marked: "toggle" (the
+	// current image), "all", "none" or "invert".
+	markChan chan string
+
+	// marksChan is sent a channel that the canvas sends the file names of
+	// the marked images on.
+	marksChan chan chan []string
+
+	// menuChan is sent a point (in window coordinates) to open the context
+	// menu at.
+	menuChan chan image.Point
+
+	// clickChan is sent the point (in window coordinates) of every press of
+	// the first mouse button, whatever it is bound to. Such a click may
+	// choose from the context menu, or open an image in the thumbnail grid
+	// or filmstrip.
+	clickChan chan image.Point
+
+	// doubleChan is sent the action bound to a double click. It isn't run
+	// if the first click was used to choose or open something.
+	doubleChan chan *action
+
 	// imgLoadChans act as synchronization points for the image generated
 	// goroutines. That is, an image doesn't start loading until its
-	// corresponding channel in the imgLoadChans slice is pinged.
-	imgLoadChans []chan struct{}
+	// corresponding channel in the imgLoadChans slice is sent how to render
+	// the image.
+	imgLoadChans []chan render
 
 	// The pan{Start,Step,End}Chan types facilitate panning. They correspond
 	// to "drag start", "drag step", and "drag end."
@@ -47,21 +195,94 @@ type chans struct {
 type imageLoaded struct {
 	img   *vimage
 	index int
+
+	// decoded is the decoded image that img was converted from.
+	decoded image.Image
+
+	// render is how the image was rendered.
+	render render
+}
+
+// added is the kind of value sent to the canvas to add images to the end of
+// the list. infos and decoded should have an entry for each image, in order.
+type added struct {
+	infos   []imgInfo
+	decoded []image.Image
+
+	// show is true when the first of the images should be shown.
+	show bool
+}
+
+// shown describes the image being shown: its index in the list (of total
+// images) and its file name. resizeEach is true when the window follows the
+// size of each image, scaling images down to fit in the work area.
+type shown struct {
+	index, total int
+	fName        string
+	resizeEach   bool
 }
 
 // canvas is meant to be run as a single goroutine that maintains the state
 // of the image viewer. It manipulates state by reading values from the channels
 // defined in the 'chans' type.
-func canvas(X *xgbutil.XUtil, window *window, names []string, nimgs int) chans {
+// names, infos and decoded should have an entry for each image, in order.
+func canvas(X *xgbutil.XUtil, window *window, names []string,
+	infos []imgInfo, decoded []image.Image) chans {
+
+	nimgs := len(infos)
 	imgChan := make(chan imageLoaded, 0)
 	drawChan := make(chan func(pt image.Point) image.Point, 0)
+	geomChan := make(chan struct{}, 0)
 	resizeToImageChan := make(chan struct{}, 0)
+	resizeEachChan := make(chan struct{}, 0)
 	prevImg := make(chan struct{}, 0)
 	nextImg := make(chan struct{}, 0)
+	stepChan := make(chan image.Point, 0)
+	thumbChan := make(chan thumbLoaded, 0)
+	gridChan := make(chan struct{}, 0)
+	openChan := make(chan struct{}, 0)
+	stripChan := make(chan struct{}, 0)
+	infoChan := make(chan struct{}, 0)
+	inspectChan := make(chan struct{}, 0)
+	pointerChan := make(chan image.Point, 0)
+	copyChan := make(chan struct{}, 0)
+	histChan := make(chan struct{}, 0)
+	histRegionChan := make(chan struct{}, 0)
+	histLoadedChan := make(chan *histogram, 0)
+	backdropChan := make(chan struct{}, 0)
+	alphaChan := make(chan struct{}, 0)
+	compareChan := make(chan struct{}, 0)
+	compareLayoutChan := make(chan struct{}, 0)
+	swapChan := make(chan struct{}, 0)
+	compareModeChan := make(chan struct{}, 0)
+	flipChan := make(chan struct{}, 0)
+	holdChan := make(chan bool, 0)
+	autoFlipChan := make(chan struct{}, 0)
+	opacityChan := make(chan int, 0)
+	diffChan := make(chan *difference, 0)
+	fitChan := make(chan fitted, 0)
+	addChan := make(chan added, 0)
+	gotoChan := make(chan int, 0)
+	shownChan := make(chan chan shown, 0)
+	commandChan := make(chan string, 0)
+	reloadChan := make(chan reloaded, 0)
+	fileChan := make(chan fileOp, 0)
+	fileDoneChan := make(chan fileDone, 0)
+	renameChan := make(chan struct{}, 0)
+	renamedChan := make(chan renamed, 0)
+	markChan := make(chan string, 0)
+	marksChan := make(chan chan []string, 0)
+	menuChan := make(chan image.Point, 0)
+	clickChan := make(chan image.Point, 0)
+	doubleChan := make(chan *action, 0)
+
+	// clicked and lastClicked are true if the last click and the one before
+	// it were used to choose or open something. Such a click doesn't pan.
+	clicked, lastClicked := false, false
 
-	imgLoadChans := make([]chan struct{}, nimgs)
+	imgLoadChans := make([]chan render, nimgs)
 	for i := range imgLoadChans {
-		imgLoadChans[i] = make(chan struct{}, 0)
+		imgLoadChans[i] = make(chan render, 0)
 	}
 
 	panStartChan := make(chan image.Point, 0)
@@ -72,9 +293,49 @@ func canvas(X *xgbutil.XUtil, window *window, names []string, nimgs int) chans {
 	chans := chans{
 		imgChan:           imgChan,
 		drawChan:          drawChan,
+		geomChan:          geomChan,
 		resizeToImageChan: resizeToImageChan,
+		resizeEachChan:    resizeEachChan,
 		prevImg:           prevImg,
 		nextImg:           nextImg,
+		stepChan:          stepChan,
+		thumbChan:         thumbChan,
+		gridChan:          gridChan,
+		openChan:          openChan,
+		stripChan:         stripChan,
+		infoChan:          infoChan,
+		inspectChan:       inspectChan,
+		pointerChan:       pointerChan,
+		copyChan:          copyChan,
+		histChan:          histChan,
+		histRegionChan:    histRegionChan,
+		histLoadedChan:    histLoadedChan,
+		backdropChan:      backdropChan,
+		alphaChan:         alphaChan,
+		compareChan:       compareChan,
+		compareLayoutChan: compareLayoutChan,
+		swapChan:          swapChan,
+		compareModeChan:   compareModeChan,
+		flipChan:          flipChan,
+		holdChan:          holdChan,
+		autoFlipChan:      autoFlipChan,
+		opacityChan:       opacityChan,
+		diffChan:          diffChan,
+		fitChan:           fitChan,
+		addChan:           addChan,
+		gotoChan:          gotoChan,
+		shownChan:         shownChan,
+		commandChan:       commandChan,
+		reloadChan:        reloadChan,
+		fileChan:          fileChan,
+		fileDoneChan:      fileDoneChan,
+		renameChan:        renameChan,
+		renamedChan:       renamedChan,
+		markChan:          markChan,
+		marksChan:         marksChan,
+		menuChan:          menuChan,
+		clickChan:         clickChan,
+		doubleChan:        doubleChan,
 
 		imgLoadChans: imgLoadChans,
 
@@ -87,6 +348,144 @@ func canvas(X *xgbutil.XUtil, window *window, names []string, nimgs int) chans {
 	window.setupEventHandlers(chans)
 	current := 0
 	origin := image.Point{0, 0}
+	grid := &grid{thumbs: make([]*xgraphics.Image, nimgs)}
+	strip := &filmstrip{thumbs: make([]*xgraphics.Image, nimgs)}
+	over := &overlay{}
+	ins := &inspector{}
+	hist := &histPanel{}
+	m := &menu{}
+	cmp := &compare{mode: "split", opacity: 50}
+
+	// marked is true for each image that has been marked.
+	marked := make([]bool, nimgs)
+
+	// undo is the list of images that have been trashed, with the last one
+	// trashed at the end. busy is true while a file operation is running.
+	// (Only one runs at a time.)
+	var undo []*trashed
+	busy := false
+
+	// flipTicker switches between images A and B in the flicker comparison
+	// mode when it's running. (flipTick is nil otherwise.)
+	var flipTicker *time.Ticker
+	var flipTick <-chan time.Time
+
+	// stopFlip stops flipTicker, since there's nothing to flip between
+	// once the flicker comparison mode is left.
+	stopFlip := func() {
+		if flipTicker != nil {
+			flipTicker.Stop()
+			flipTicker, flipTick = nil, nil
+		}
+	}
+
+	// held is true while a key bound to flip-compare is held down.
+	held := false
+
+	// rend is how images are rendered: the backdrop that they are blended
+	// into and the alpha mode.
+	rend := render{backdrop: flagBackdrop, alpha: "normal"}
+
+	// resizeEach is true when the window follows the size of each image.
+	resizeEach := flagResizeEach
+
+	// fits are the images that have been scaled down to fit in fitBox (the
+	// biggest the viewport can be), by decoded image. Images are only
+	// scaled down when the window follows the size of each image, and an
+	// image that is still being scaled has a nil entry.
+	fits := make(map[image.Image]*vimage)
+	fitBox := image.Point{}
+
+	// forgetFit destroys the scaled down copy of the image decoded as d.
+	forgetFit := func(d image.Image) {
+		if fits[d] != nil {
+			fits[d].Destroy()
+		}
+		delete(fits, d)
+	}
+
+	// refit finds the biggest size of the viewport again, since it depends
+	// on the monitor that the window is on and on the filmstrip. Images
+	// that were scaled down for a different size are forgotten.
+	refit := func() {
+		box := window.maxViewport()
+		if box == fitBox {
+			return
+		}
+		for d := range fits {
+			forgetFit(d)
+		}
+		fitBox = box
+	}
+
+	// display returns the image to paint for the image at index i: the
+	// converted image, or a copy of it that is scaled down to fit in the
+	// work area when the window follows the size of each image. nil is
+	// returned while either one is still loading.
+	display := func(i int) *vimage {
+		img := imgs[i]
+		if img == nil || !resizeEach {
+			return img
+		}
+		if _, scale := fitSize(img.Bounds().Size(), fitBox); scale == 0 {
+			return img
+		}
+		d := decoded[i]
+		if fit, ok := fits[d]; ok {
+			return fit
+		}
+		fits[d] = nil
+		go fitImage(X, img, d, fitBox, rend, fitChan)
+		return nil
+	}
+
+	// hinted is the index of the image that the window's hints and icon
+	// describe.
+	hinted := -1
+
+	// identify sets the window's hints and icon to describe the current
+	// image. It should be called again whenever the thumbnail grid or the
+	// comparison mode is entered or left.
+	identify := func() {
+		bounds := decoded[current].Bounds()
+		window.hintsSet(bounds.Dx(), bounds.Dy(),
+			!grid.active && !cmp.active)
+		window.iconSet(strip.thumbs[current], grid.thumbs[current])
+		hinted = current
+	}
+
+	// decorate draws everything that goes on top of the current image.
+	// (The pixel inspector and histogram only describe a single image, so
+	// they aren't shown in the comparison mode.)
+	decorate := func() {
+		strip.draw(window, current)
+		over.stats = cmp.stats()
+		over.marked, over.nmarked = marked[current], countMarked(marked)
+		over.zoom = 100
+		if img := display(current); img != nil && !cmp.active {
+			over.zoom = img.zoom()
+		}
+		over.draw(window, infos[current], current, nimgs)
+		if !cmp.active {
+			img := display(current)
+			ins.draw(window, decoded[current], img, origin)
+			hist.draw(window, hist.key(window, decoded[current], img,
+				origin), histLoadedChan)
+		}
+		if marked[current] {
+			drawMark(window)
+		}
+		window.drawPrompt()
+		m.draw(window)
+	}
+
+	// load starts loading the image at index i, if it hasn't been already.
+	load := func(i int) {
+		if imgs[i] == nil && imgLoadChans[i] != nil {
+			imgLoadChans[i] <- rend
+			imgLoadChans[i] = nil
+		}
+	}
 
 	setImage := func(i int, pt image.Point) {
 		if i >= len(imgs) {
@@ -95,48 +494,691 @@ func canvas(X *xgbutil.XUtil, window *window, names []string, nimgs int) chans {
 		if i < 0 {
 			i = len(imgs) - 1
 		}
+		if grid.active {
+			return
+		}
+		if cmp.active {
+			// Image A is always the current image in the comparison mode.
+			current = cmp.a
+			origin = cmp.originTrans(window, decoded, pt)
+			cmp.draw(window, imgs, decoded, names, origin, diffChan)
+			decorate()
+			load(cmp.a)
+			load(cmp.b)
+			return
+		}
 		if current != i {
 			window.ClearAll()
+			if resizeEach {
+				refit()
+				size, _ := fitSize(decoded[i].Bounds().Size(), fitBox)
+				window.fitResize(size.X, size.Y+strip.height())
+			}
 		}
 
 		current = i
-		if imgs[i] == nil {
+		if hinted != current {
+			identify()
+		}
+		defer decorate()
+		if display(i) == nil {
 			window.nameSet(fmt.Sprintf("%s - Loading...", names[i]))
+			load(i)
+			return
+		}
 
-			if imgLoadChans[i] != nil {
-				imgLoadChans[i] <- struct{}{}
-				imgLoadChans[i] = nil
+		origin = originTrans(pt, window, display(i))
+		show(window, display(i), origin, i, infos[i].fName)
+	}
+
+	// find returns the index of the image decoded as d, or -1 if it isn't
+	// in the list anymore. Images can move around in the list while they're
+	// being loaded, so hint (where the image was) is checked first.
+	find := func(d image.Image, hint int) int {
+		if hint >= 0 && hint < nimgs && decoded[hint] == d {
+			return hint
+		}
+		for i := range decoded {
+			if decoded[i] == d {
+				return i
 			}
+		}
+		return -1
+	}
+
+	// remove takes the image at index i out of the list.
+	remove := func(i int) {
+		forgetFit(decoded[i])
+		if imgs[i] != nil {
+			imgs[i].Destroy()
+		}
+		if imgLoadChans[i] != nil {
+			close(imgLoadChans[i])
+		}
+		for _, thumb := range []*xgraphics.Image{
+			grid.thumbs[i], strip.thumbs[i],
+		} {
+			if thumb != nil {
+				thumb.Destroy()
+			}
+		}
+		infos = append(infos[:i], infos[i+1:]...)
+		decoded = append(decoded[:i], decoded[i+1:]...)
+		names = append(names[:i], names[i+1:]...)
+		imgs = append(imgs[:i], imgs[i+1:]...)
+		imgLoadChans = append(imgLoadChans[:i], imgLoadChans[i+1:]...)
+		grid.thumbs = append(grid.thumbs[:i], grid.thumbs[i+1:]...)
+		strip.thumbs = append(strip.thumbs[:i], strip.thumbs[i+1:]...)
+		marked = append(marked[:i], marked[i+1:]...)
+		nimgs = len(imgs)
+	}
+
+	// insert puts an image into the list at index i, and starts converting
+	// it and making its thumbnails.
+	insert := func(i int, info imgInfo, d image.Image) {
+		loadChan := make(chan render, 0)
+		infos = append(infos[:i], append([]imgInfo{info}, infos[i:]...)...)
+		decoded = append(decoded[:i],
+			append([]image.Image{d}, decoded[i:]...)...)
+		names = append(names[:i],
+			append([]string{basename(info.fName)}, names[i:]...)...)
+		imgs = append(imgs[:i], append([]*vimage{nil}, imgs[i:]...)...)
+		imgLoadChans = append(imgLoadChans[:i],
+			append([]chan render{loadChan}, imgLoadChans[i:]...)...)
+		grid.thumbs = append(grid.thumbs[:i],
+			append([]*xgraphics.Image{nil}, grid.thumbs[i:]...)...)
+		strip.thumbs = append(strip.thumbs[:i],
+			append([]*xgraphics.Image{nil}, strip.thumbs[i:]...)...)
+		marked = append(marked[:i], append([]bool{false}, marked[i:]...)...)
+		nimgs = len(imgs)
+
+		go newImage(X, names[i], d, i, loadChan, imgChan)
+		go thumbnails(X, []string{info.fName}, []image.Image{d}, i,
+			thumbChan)
+	}
+
+	// shift redraws everything after images have been taken out of or put
+	// into the list, showing the image at index i. Anything that refers to
+	// images by their index is forgotten.
+	shift := func(i int) {
+		cmp.active = false
+		cmp.clear()
+		hinted = -1
+
+		i = max(0, min(i, nimgs-1))
+		current = max(0, min(current, nimgs-1))
+		window.ClearAll()
+		if grid.active {
+			grid.selected = i
+			grid.draw(window, names, marked)
 			return
 		}
 
-		origin = originTrans(pt, window, imgs[current])
-		show(window, imgs[i], origin)
+		// So that setImage treats this as a new image.
+		current = -1
+		setImage(i, image.Point{0, 0})
+	}
+
+	// rerender converts every image again from the decoded images, since the
+	// backdrop and alpha mode are baked into each converted image.
+	rerender := func() {
+		for d := range fits {
+			forgetFit(d)
+		}
+		for i := range imgs {
+			if imgs[i] != nil {
+				imgs[i].Destroy()
+				imgs[i] = nil
+			}
+			if imgLoadChans[i] == nil {
+				imgLoadChans[i] = make(chan render, 0)
+				go newImage(X, names[i], decoded[i], i,
+					imgLoadChans[i], imgChan)
+			}
+		}
+		if !grid.active {
+			window.ClearAll()
+			setImage(current, origin)
+		}
+	}
+
+	// openImage leaves the thumbnail grid and shows the image at index i.
+	openImage := func(i int) {
+		grid.active = false
+		hinted = -1
+		window.ClearAll()
+		setImage(i, image.Point{0, 0})
 	}
 
 	go func() {
 		for {
 			select {
 			case img := <-imgChan:
+				// The backdrop or alpha mode may have changed while the image
+				// was loading, or the image may have been reloaded or taken
+				// out of the list.
+				img.index = find(img.decoded, img.index)
+				if img.render != rend || img.index == -1 {
+					img.img.Destroy()
+					break
+				}
 				imgs[img.index] = img.img
 
+				// The image has been decoded by now, so its color model
+				// can be described fully.
+				infos[img.index].model = colorModelName(pixels(img.decoded))
+
 				// If this is the current image, show it!
-				if current == img.index {
-					show(window, imgs[current], origin)
+				if cmp.active && (cmp.a == img.index || cmp.b == img.index) {
+					setImage(current, origin)
+				} else if current == img.index && !grid.active {
+					setImage(current, origin)
+				}
+			case fit := <-fitChan:
+				// The image may have been reloaded, taken out of the list
+				// or rendered again, or the window may have moved to
+				// another monitor since.
+				i := find(fit.decoded, -1)
+				if f, ok := fits[fit.decoded]; !ok || f != nil || i == -1 ||
+					fit.box != fitBox || fit.render != rend {
+
+					fit.img.Destroy()
+					break
+				}
+				// The image may also have been renamed.
+				fit.img.name = names[i]
+				fits[fit.decoded] = fit.img
+				if i == current && !cmp.active && !grid.active {
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case thumb := <-thumbChan:
+				thumb.index = find(thumb.decoded, thumb.index)
+				if thumb.index == -1 {
+					thumb.img.Destroy()
+					thumb.small.Destroy()
+					break
+				}
+				grid.thumbs[thumb.index] = thumb.img
+				strip.thumbs[thumb.index] = thumb.small
+				if thumb.index == current {
+					window.iconSet(thumb.small, thumb.img)
+				}
+				if grid.active {
+					grid.drawCell(window, thumb.index,
+						marked[thumb.index])
+					window.drawPrompt()
+				} else {
+					strip.draw(window, current)
 				}
 			case funpt := <-drawChan:
-				setImage(current, funpt(origin))
+				if grid.active {
+					grid.draw(window, names, marked)
+				} else {
+					setImage(current, funpt(origin))
+				}
+			case <-geomChan:
+				if resizeEach {
+					refit()
+				}
+				window.ClearAll()
+				if grid.active {
+					grid.draw(window, names, marked)
+				} else {
+					setImage(current, origin)
+				}
 			case <-resizeToImageChan:
-				window.Resize(imgs[current].Bounds().Dx(),
-					imgs[current].Bounds().Dy())
+				img := display(current)
+				if img == nil {
+					break
+				}
+				window.fitResize(img.Bounds().Dx(),
+					img.Bounds().Dy()+strip.height())
+			case <-resizeEachChan:
+				resizeEach = !resizeEach
+				if grid.active {
+					break
+				}
+				if resizeEach {
+					refit()
+					size, _ := fitSize(decoded[current].Bounds().Size(),
+						fitBox)
+					window.fitResize(size.X, size.Y+strip.height())
+				}
+				window.ClearAll()
+				setImage(current, origin)
 			case <-prevImg:
-				setImage(current-1, image.Point{0, 0})
+				if grid.active {
+					grid.move(window, -1, 0)
+					grid.draw(window, names, marked)
+				} else if cmp.active {
+					cmp.next(nimgs, -1)
+					setImage(current, origin)
+				} else {
+					setImage(current-1, image.Point{0, 0})
+				}
 			case <-nextImg:
-				setImage(current+1, image.Point{0, 0})
+				if grid.active {
+					grid.move(window, 1, 0)
+					grid.draw(window, names, marked)
+				} else if cmp.active {
+					cmp.next(nimgs, 1)
+					setImage(current, origin)
+				} else {
+					setImage(current+1, image.Point{0, 0})
+				}
+			case dir := <-stepChan:
+				if grid.active {
+					grid.move(window, dir.X, dir.Y)
+					grid.draw(window, names, marked)
+				} else {
+					setImage(current, origin.Add(dir.Mul(flagStepIncrement)))
+				}
+			case <-gridChan:
+				if grid.active {
+					openImage(current)
+				} else {
+					cmp.active = false
+					grid.active = true
+					grid.selected = current
+					identify()
+					grid.draw(window, names, marked)
+				}
+			case <-openChan:
+				if grid.active {
+					openImage(grid.selected)
+				}
+			case <-stripChan:
+				strip.active = !strip.active
+				window.stripHeight = strip.height()
+				if resizeEach {
+					refit()
+				}
+				identify()
+				if !grid.active {
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case <-infoChan:
+				over.active = !over.active
+				if !grid.active {
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case <-inspectChan:
+				ins.active = !ins.active
+				window.trackPointer(ins.active || m.active)
+				if !grid.active {
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case pt := <-pointerChan:
+				ins.pointer = pt
+				hovered := m.active && m.hover(window, pt)
+				inspect := ins.active && !cmp.active
+				if (inspect || hovered) && !grid.active {
+					setImage(current, origin)
+				}
+			case <-backdropChan:
+				rend.backdrop = cycle(backdrops, rend.backdrop)
+				lg("Switched to the %s backdrop.", rend.backdrop)
+				rerender()
+			case <-alphaChan:
+				rend.alpha = cycle(alphaModes, rend.alpha)
+				over.alpha = rend.alpha
+				lg("Switched to the %s alpha mode.", rend.alpha)
+				rerender()
+			case <-compareChan:
+				if grid.active {
+					break
+				}
+				if cmp.active {
+					cmp.active = false
+					stopFlip()
+				} else {
+					cmp.start(current, nimgs)
+				}
+				identify()
+				window.ClearAll()
+				setImage(current, image.Point{0, 0})
+			case <-compareLayoutChan:
+				cmp.stacked = !cmp.stacked
+				if cmp.active && !grid.active {
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case <-swapChan:
+				if cmp.active && !grid.active {
+					cmp.swap()
+					setImage(current, origin)
+				}
+			case <-compareModeChan:
+				if cmp.active && !grid.active {
+					cmp.mode = cycle(compareModes, cmp.mode)
+					if cmp.mode != "flicker" {
+						stopFlip()
+					}
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case <-flipChan:
+				if cmp.active && cmp.mode == "flicker" && !grid.active {
+					cmp.showB = !cmp.showB
+					setImage(current, origin)
+				}
+			case show := <-holdChan:
+				// A release without a press (i.e., the press was typed
+				// into the prompt) is ignored.
+				if !show && !held {
+					break
+				}
+				held = show
+				flicker := cmp.active && cmp.mode == "flicker"
+				if flicker && !grid.active && cmp.showB != show {
+					cmp.showB = show
+					setImage(current, origin)
+				}
+			case <-autoFlipChan:
+				if flipTicker != nil {
+					stopFlip()
+				} else {
+					interval := time.Duration(flagFlickerInterval)
+					flipTicker = time.NewTicker(interval * time.Millisecond)
+					flipTick = flipTicker.C
+				}
+			case <-flipTick:
+				// The comparison mode may have been left some other way.
+				// (i.e., by switching to the thumbnail grid.)
+				if !cmp.active || cmp.mode != "flicker" {
+					stopFlip()
+				} else if !grid.active {
+					cmp.showB = !cmp.showB
+					setImage(current, origin)
+				}
+			case delta := <-opacityChan:
+				cmp.opacity = max(0, min(100, cmp.opacity+delta))
+				if cmp.active && cmp.mode == "onion" && !grid.active {
+					setImage(current, origin)
+				}
+			case diff := <-diffChan:
+				if cmp.loaded(diff) && !grid.active {
+					setImage(current, origin)
+				}
+			case add := <-addChan:
+				first := len(imgs)
+				fNames := make([]string, len(add.infos))
+				for i, info := range add.infos {
+					index := len(imgs)
+					fNames[i] = info.fName
+					infos = append(infos, info)
+					decoded = append(decoded, add.decoded[i])
+					names = append(names, basename(info.fName))
+					imgs = append(imgs, nil)
+					grid.thumbs = append(grid.thumbs, nil)
+					strip.thumbs = append(strip.thumbs, nil)
+					marked = append(marked, false)
+					imgLoadChans = append(imgLoadChans, make(chan render, 0))
+					go newImage(X, names[index], decoded[index], index,
+						imgLoadChans[index], imgChan)
+				}
+				nimgs = len(imgs)
+				go thumbnails(X, fNames, add.decoded, first, thumbChan)
+				lg("Added %d images to the list.", len(add.infos))
+
+				switch {
+				case grid.active:
+					grid.draw(window, names, marked)
+				case add.show && len(add.infos) > 0:
+					cmp.active = false
+					hinted = -1
+					setImage(first, image.Point{0, 0})
+				default:
+					// The overlay and filmstrip show the number of images.
+					setImage(current, origin)
+				}
+			case i := <-gotoChan:
+				if i < 0 || i >= nimgs {
+					break
+				}
+				if grid.active {
+					grid.selected = i
+					grid.draw(window, names, marked)
+				} else {
+					cmp.a = i
+					setImage(i, image.Point{0, 0})
+				}
+			case reply := <-shownChan:
+				reply <- shown{current, nimgs, infos[current].fName,
+					resizeEach}
+			case line := <-commandChan:
+				i := current
+				if grid.active {
+					i = grid.selected
+				}
+				fName := infos[i].fName
+				go runCommand(expandCommand(line, i, fName), fName,
+					decoded[i], reloadChan)
+			case r := <-reloadChan:
+				// The list may have changed while the command was running.
+				i := find(r.old, -1)
+				if i == -1 {
+					break
+				}
+				forgetFit(r.old)
+				infos[i], decoded[i] = r.info, r.decoded
+				if imgs[i] != nil {
+					imgs[i].Destroy()
+					imgs[i] = nil
+				}
+				if imgLoadChans[i] != nil {
+					close(imgLoadChans[i])
+				}
+				imgLoadChans[i] = make(chan render, 0)
+				go newImage(X, names[i], decoded[i], i,
+					imgLoadChans[i], imgChan)
+				go thumbnails(X, []string{r.info.fName},
+					[]image.Image{r.decoded}, i, thumbChan)
+				cmp.forget(i)
+				lg("Reloaded '%s'.", r.info.fName)
+
+				if grid.active {
+					break
+				}
+				if i == current {
+					hinted = -1
+				}
+				window.ClearAll()
+				setImage(current, origin)
+			case op := <-fileChan:
+				if busy {
+					errLg.Println("Still busy with the last file operation.")
+					break
+				}
+				if op.kind == "undo" {
+					if len(undo) == 0 {
+						errLg.Println("There is nothing to undo.")
+						break
+					}
+					busy = true
+					go untrash(undo[len(undo)-1], fileDoneChan)
+					undo = undo[:len(undo)-1]
+					break
+				}
+				i := current
+				if grid.active {
+					i = grid.selected
+				}
+				if op.kind != "copy" && nimgs == 1 {
+					errLg.Printf("Can't %s the only image.", op.kind)
+					break
+				}
+				busy = true
+				go op.run(i, infos[i], decoded[i], fileDoneChan)
+			case done := <-fileDoneChan:
+				busy = false
+				if done.err != nil {
+					errLg.Println(done.err)
+					if done.op.kind == "undo" {
+						undo = append(undo, done.trashed)
+					}
+					break
+				}
+				switch done.op.kind {
+				case "undo":
+					// The restored image is shown where it used to be.
+					i := min(done.trashed.index, nimgs)
+					insert(i, done.trashed.info, done.trashed.decoded)
+					if i <= current {
+						current++
+					}
+					shift(i)
+				case "trash", "move":
+					// The image is replaced by the one after it. (The user
+					// may have moved on to another image since, which is
+					// kept.)
+					i := find(done.decoded, -1)
+					if i == -1 {
+						break
+					}
+					if done.trashed != nil {
+						done.trashed.index = i
+						undo = append(undo, done.trashed)
+					}
+					remove(i)
+					if i < current {
+						current--
+					}
+					if i < grid.selected {
+						grid.selected--
+					}
+					if grid.active {
+						shift(grid.selected)
+					} else {
+						shift(current)
+					}
+				}
+			case <-renameChan:
+				i := current
+				if grid.active {
+					i = grid.selected
+				}
+				d := decoded[i]
+				window.openPrompt("Rename to: ", names[i], func(name string) {
+					renamedChan <- renamed{d, name}
+				})
+				if grid.active {
+					grid.draw(window, names, marked)
+				} else {
+					setImage(current, origin)
+				}
+			case r := <-renamedChan:
+				// The list may have changed while the name was typed.
+				if i := find(r.decoded, -1); i > -1 {
+					fName, err := renameFile(infos[i].fName, r.name)
+					if err != nil {
+						errLg.Println(err)
+					} else {
+						lg("Renamed '%s' to '%s'.", infos[i].fName, fName)
+						infos[i].fName, names[i] = fName, basename(fName)
+						if l, ok := decoded[i].(*lazyImage); ok {
+							l.rename(fName)
+						}
+						if imgs[i] != nil {
+							imgs[i].name = names[i]
+						}
+						if fits[decoded[i]] != nil {
+							fits[decoded[i]].name = names[i]
+						}
+					}
+				}
+				window.ClearAll()
+				if grid.active {
+					grid.draw(window, names, marked)
+				} else {
+					setImage(current, origin)
+				}
+			case op := <-markChan:
+				i := current
+				if grid.active {
+					i = grid.selected
+				}
+				mark(marked, i, op)
+				lg("%d of %d images are marked.", countMarked(marked), nimgs)
+				if grid.active {
+					grid.draw(window, names, marked)
+				} else {
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case reply := <-marksChan:
+				reply <- markedFiles(infos, marked)
+			case pt := <-menuChan:
+				if grid.active {
+					break
+				}
+				m.open(window, pt)
+				window.trackPointer(true)
+				m.draw(window)
+			case <-histChan:
+				hist.active = !hist.active
+				if !grid.active {
+					window.ClearAll()
+					setImage(current, origin)
+				}
+			case <-histRegionChan:
+				hist.visible = !hist.visible
+				if hist.active && !grid.active {
+					setImage(current, origin)
+				}
+			case h := <-histLoadedChan:
+				if hist.loaded(h) && !grid.active {
+					decorate()
+				}
+			case <-copyChan:
+				if len(ins.hex) > 0 {
+					window.copyText(ins.hex)
+					lg("Copied '%s' to the clipboard.", ins.hex)
+				}
+			case pt := <-clickChan:
+				// A click anywhere closes the context menu, and a click in
+				// the grid shows the image that was clicked on.
+				lastClicked, clicked = clicked, true
+				if m.active {
+					m.choose(window, pt)
+					window.trackPointer(ins.active)
+					window.ClearAll()
+					setImage(current, origin)
+				} else if grid.active {
+					i := grid.cellAt(window, pt)
+					if i == -1 {
+						clicked = false
+						break
+					}
+					openImage(i)
+				} else if i := strip.cellAt(window, current, pt); i > -1 {
+					// A click in the filmstrip jumps to that image. (Or
+					// compares it with image A in the comparison mode.)
+					if cmp.active {
+						cmp.b = i
+						setImage(current, origin)
+					} else {
+						setImage(i, image.Point{0, 0})
+					}
+				} else {
+					clicked = false
+				}
+			case act := <-doubleChan:
+				// Both clicks have already been sent on clickChan.
+				if !lastClicked {
+					go act.run(window)
+				}
 			case pt := <-panStartChan:
 				panStart = pt
 				panOrigin = origin
 			case pt := <-panStepChan:
+				if grid.active || clicked {
+					break
+				}
 				xd, yd := panStart.X-pt.X, panStart.Y-pt.Y
 				setImage(current,
 					image.Point{xd + panOrigin.X, yd + panOrigin.Y})
@@ -160,7 +1202,7 @@ func originTrans(pt image.Point, win *window, img *vimage) image.Point {
 	}
 
 	// Quick aliases.
-	ww, wh := win.Geom.Width(), win.Geom.Height()
+	ww, wh := win.viewport()
 	dw := img.Bounds().Dx() - ww
 	dh := img.Bounds().Dy() - wh
 
@@ -185,9 +1227,12 @@ func originTrans(pt image.Point, win *window, img *vimage) image.Point {
 }
 
 // show translates the given origin point, paints the appropriate part of the
-// current image to the canvas, and sets the name of the window.
+// current image to the canvas, and sets the name of the window. The index and
+// file name of the image are published in the window's properties.
 // (Painting only paints the sub-image that is viewable.)
-func show(win *window, img *vimage, pt image.Point) {
+func show(win *window, img *vimage, pt image.Point, index int,
+	fName string) {
+
 	// If there's no valid image, don't bother trying to show it.
 	// (We're hopefully loading the image now.)
 	if img == nil {
@@ -198,10 +1243,17 @@ func show(win *window, img *vimage, pt image.Point) {
 	pt = originTrans(pt, win, img)
 
 	// Now paint the sub-image to the window.
+	vw, vh := win.viewport()
 	win.paint(img.SubImage(image.Rect(pt.X, pt.Y,
-		pt.X+win.Geom.Width(), pt.Y+win.Geom.Height())).(*xgraphics.Image))
+		pt.X+vw, pt.Y+vh)).(*xgraphics.Image))
 
 	// Always set the name of the window when we update it with a new image.
-	win.nameSet(fmt.Sprintf("%s (%dx%d)",
-		img.name, img.Bounds().Dx(), img.Bounds().Dy()))
+	name := fmt.Sprintf("%s (%dx%d)",
+		img.name, img.Bounds().Dx(), img.Bounds().Dy())
+	if img.scale > 0 {
+		name = fmt.Sprintf("%s (%dx%d at %d%%)",
+			img.name, img.Bounds().Dx(), img.Bounds().Dy(), img.zoom())
+	}
+	win.nameSet(name)
+	win.currentSet(index, fName)
 }
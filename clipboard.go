@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/BurntSushi/xgbutil/xprop"
+)
+
+// clipboard holds the text that imgv offers to other clients through the
+// CLIPBOARD and PRIMARY selections. The text is set by the canvas goroutine
+// and read by the X event loop, so it is protected by a mutex.
+type clipboard struct {
+	sync.Mutex
+	text string
+}
+
+// copyText makes the window the owner of the CLIPBOARD and PRIMARY
+// selections, and offers text to anyone who asks for their contents.
+func (w *window) copyText(text string) {
+	w.clip.Lock()
+	w.clip.text = text
+	w.clip.Unlock()
+
+	for _, name := range []string{"CLIPBOARD", "PRIMARY"} {
+		sel, err := xprop.Atm(w.X, name)
+		if err != nil {
+			errLg.Printf("Could not copy to %s: %s", name, err)
+			continue
+		}
+		xproto.SetSelectionOwner(w.X.Conn(), w.Id, sel,
+			xproto.TimeCurrentTime)
+	}
+}
+
+// selectionRequest responds to a client asking for the contents of a
+// selection owned by the window. The text can be converted to STRING or
+// UTF8_STRING, and TARGETS lists those conversions. The requesting client is
+// always sent a SelectionNotify event, even if the conversion failed.
+func (w *window) selectionRequest(X *xgbutil.XUtil,
+	ev xevent.SelectionRequestEvent) {
+
+	w.clip.Lock()
+	text := w.clip.text
+	w.clip.Unlock()
+
+	// Obsolete clients don't set a property, and expect us to use the target.
+	prop := ev.Property
+	if prop == xproto.AtomNone {
+		prop = ev.Target
+	}
+
+	target, err := xprop.AtomName(X, ev.Target)
+	if err != nil {
+		errLg.Printf("Could not get the name of a selection target: %s", err)
+		target = ""
+	}
+	switch target {
+	case "TARGETS":
+		atoms := make([]byte, 0, 12)
+		for _, name := range []string{"TARGETS", "UTF8_STRING", "STRING"} {
+			if atom, err := xprop.Atm(X, name); err == nil {
+				atoms = append(atoms, byte(atom), byte(atom>>8),
+					byte(atom>>16), byte(atom>>24))
+			}
+		}
+		xproto.ChangeProperty(X.Conn(), xproto.PropModeReplace,
+			ev.Requestor, prop, xproto.AtomAtom, 32,
+			uint32(len(atoms)/4), atoms)
+	case "UTF8_STRING", "STRING":
+		xproto.ChangeProperty(X.Conn(), xproto.PropModeReplace,
+			ev.Requestor, prop, ev.Target, 8,
+			uint32(len(text)), []byte(text))
+	default:
+		prop = xproto.AtomNone
+	}
+
+	notify := xproto.SelectionNotifyEvent{
+		Time:      ev.Time,
+		Requestor: ev.Requestor,
+		Selection: ev.Selection,
+		Target:    ev.Target,
+		Property:  prop,
+	}
+	xproto.SendEvent(X.Conn(), false, ev.Requestor,
+		xproto.EventMaskNoEvent, string(notify.Bytes()))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reloadStatus is the exit status that a command uses to tell imgv that it
+// changed the image file, so the image should be decoded again.
+const reloadStatus = 10
+
+// reloaded is the kind of value sent to the canvas when an image has been
+// decoded again after a command changed its file. The image is identified by
+// the decoded image it replaces (old), since the list may have changed
+// while the command was running.
+type reloaded struct {
+	old     image.Image
+	info    imgInfo
+	decoded image.Image
+}
+
+// commandAction defines a new action called name that runs the shell
+// command line on the current image. (See expandCommand.) It is an error if
+// there's already an action called name.
+func commandAction(name, line string) error {
+	if findAction(name) != nil {
+		return fmt.Errorf("There is already an action named '%s'.", name)
+	}
+	actions = append(actions, action{
+		name, fmt.Sprintf("Run '%s'.", line),
+		func(w *window) { w.chans.commandChan <- line },
+	})
+	return nil
+}
+
+// expandCommand replaces the placeholders in the command line with a
+// description of the image at index (whose file is fName):
+//
+//	%f: the absolute file name.
+//	%n: the base name of the file.
+//	%d: the directory the file is in.
+//	%i: the number of the image in the list. (The first image is 1.)
+//	%%: a single '%'.
+//
+// File names are quoted for the shell, so they shouldn't be quoted in the
+// command line.
+func expandCommand(line string, index int, fName string) string {
+	if abs, err := filepath.Abs(fName); err == nil {
+		fName = abs
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(line); i++ {
+		if line[i] != '%' || i == len(line)-1 {
+			buf.WriteByte(line[i])
+			continue
+		}
+		i++
+		switch line[i] {
+		case 'f':
+			buf.WriteString(shellQuote(fName))
+		case 'n':
+			buf.WriteString(shellQuote(filepath.Base(fName)))
+		case 'd':
+			buf.WriteString(shellQuote(filepath.Dir(fName)))
+		case 'i':
+			buf.WriteString(strconv.Itoa(index + 1))
+		case '%':
+			buf.WriteByte('%')
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(line[i])
+		}
+	}
+	return buf.String()
+}
+
+// shellQuote quotes s so that the shell treats it as a single word.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// runCommand is meant to be run as a goroutine and runs the (expanded)
+// shell command line for the image decoded as old, whose file is fName. The
+// command's output goes to imgv's stderr, since stdout is kept for the
+// marked images. (See printMarks.) If the command exits with reloadStatus,
+// the image is decoded again and sent on reloadChan.
+func runCommand(line string, fName string, old image.Image,
+	reloadChan chan reloaded) {
+
+	lg("Running '%s'.", line)
+	start := time.Now()
+	cmd := exec.Command("/bin/sh", "-c", line)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	err := cmd.Run()
+	if err == nil {
+		lg("'%s' finished (%s).", line, time.Since(start))
+		return
+	}
+
+	exit, ok := err.(*exec.ExitError)
+	if !ok {
+		errLg.Printf("Could not run '%s': %s", line, err)
+		return
+	}
+	status, ok := exit.Sys().(syscall.WaitStatus)
+	if !ok || status.ExitStatus() != reloadStatus {
+		errLg.Printf("'%s' failed: %s", line, err)
+		return
+	}
+
+	lg("'%s' asked for '%s' to be reloaded.", line, fName)
+	infos, decoded := openImages([]string{fName})
+	if len(infos) == 0 {
+		errLg.Printf("Could not reload '%s'.", fName)
+		return
+	}
+	reloadChan <- reloaded{old, infos[0], decoded[0]}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestExpandCommand(t *testing.T) {
+	fName := "/tmp/dir/a b.png"
+	tests := []struct {
+		line, want string
+	}{
+		{"", ""},
+		{"gimp %f", "gimp '/tmp/dir/a b.png'"},
+		{"echo %n in %d", "echo 'a b.png' in '/tmp/dir'"},
+		{"echo %i", "echo 3"},
+		{"echo 100%%", "echo 100%"},
+		{"echo %%f", "echo %f"},
+		{"echo %x", "echo %x"},
+		{"echo 100%", "echo 100%"},
+		{"%f%n", "'/tmp/dir/a b.png''a b.png'"},
+	}
+	for _, test := range tests {
+		got := expandCommand(test.line, 2, fName)
+		if got != test.want {
+			t.Errorf("expandCommand(%q) = %q, want %q",
+				test.line, got, test.want)
+		}
+	}
+
+	// File names are cleaned up, since they are made absolute.
+	if got := expandCommand("%f", 0, "/tmp/dir/../a.png"); got !=
+		"'/tmp/a.png'" {
+
+		t.Errorf("expandCommand(%%f) = %q, want '/tmp/a.png'", got)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []string{
+		"",
+		"a",
+		"a b",
+		"it's",
+		"''",
+		`"$HOME" $(ls) ` + "`ls`",
+		`back\slash`,
+		"new\nline",
+		"*?[a]",
+	}
+	for _, s := range tests {
+		out, err := exec.Command("/bin/sh", "-c",
+			"printf '%s' "+shellQuote(s)).Output()
+		if err != nil {
+			t.Errorf("shellQuote(%q): %s", s, err)
+		} else if string(out) != s {
+			t.Errorf("shellQuote(%q) = %s, which the shell reads as %q",
+				s, shellQuote(s), out)
+		}
+	}
+}
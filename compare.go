@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/BurntSushi/xgbutil/xgraphics"
+)
+
+// compareModes is the list of ways that two images can be compared, in the
+// order that the cycle-compare-mode action goes through them.
+//
+//	split: A and B side by side (or stacked).
+//	flicker: A or B, switching between them on request or on a timer.
+//	onion: B blended over A, with an adjustable opacity.
+//	diff: a heatmap of the difference between A and B.
+var compareModes = []string{"split", "flicker", "onion", "diff"}
+
+// comparePad is the width (in pixels) of the line between the two panes of
+// the comparison mode.
+const comparePad = 2
+
+// compare keeps the state of the comparison mode, which shows two images
+// from the list (A and B) in one of the compareModes. In the split mode, the
+// images are in two panes, either side by side or stacked. Otherwise, they
+// share the whole viewport. Either way, they share the canvas' origin, so
+// they always pan together. (imgv doesn't zoom, so both images are always at
+// the same scale.) It is only ever touched by the canvas goroutine.
+type compare struct {
+	// active is true when the comparison mode is shown.
+	active bool
+
+	// mode is one of compareModes.
+	mode string
+
+	// showB is true when image B is shown in the flicker mode.
+	showB bool
+
+	// opacity is the opacity (in percent) of image B in the onion mode.
+	opacity int
+
+	// stacked is true when the panes are on top of each other, rather than
+	// side by side.
+	stacked bool
+
+	// a and b are the indices of the images in the first and second panes.
+	a, b int
+
+	// diff is the last difference computed, which may not be for the
+	// current images. pending is the difference currently being computed,
+	// if any.
+	diff    *difference
+	pending *diffKey
+}
+
+// start shows image a compared with the image after it.
+func (c *compare) start(a, nimgs int) {
+	c.active, c.showB = true, false
+	c.a, c.b = a, a
+	c.next(nimgs, 1)
+}
+
+// next changes image B to the image dir steps away from it, skipping over
+// image A.
+func (c *compare) next(nimgs, dir int) {
+	c.b = (c.b + dir + nimgs) % nimgs
+	if c.b == c.a && nimgs > 1 {
+		c.b = (c.b + dir + nimgs) % nimgs
+	}
+}
+
+// swap switches the images in the two panes.
+func (c *compare) swap() {
+	c.a, c.b = c.b, c.a
+}
+
+// panes returns the part of the viewport (in window coordinates) that each
+// of images A and B are painted in. This is the whole viewport for both,
+// except in the split mode.
+func (c *compare) panes(win *window) (image.Rectangle, image.Rectangle) {
+	vw, vh := win.viewport()
+	if c.mode != "split" {
+		return image.Rect(0, 0, vw, vh), image.Rect(0, 0, vw, vh)
+	}
+	if c.stacked {
+		half := (vh - comparePad) / 2
+		return image.Rect(0, 0, vw, half),
+			image.Rect(0, half+comparePad, vw, vh)
+	}
+	half := (vw - comparePad) / 2
+	return image.Rect(0, 0, half, vh), image.Rect(half+comparePad, 0, vw, vh)
+}
+
+// size returns the size of the area that both images are laid out in, which
+// is big enough for the larger of the two in each dimension. Both images are
+// aligned at the top-left corner of this area, so that the same pixel of
+// each image is in the same place in each pane.
+func (c *compare) size(decoded []image.Image) image.Point {
+	ra, rb := decoded[c.a].Bounds(), decoded[c.b].Bounds()
+	return image.Point{max(ra.Dx(), rb.Dx()), max(ra.Dy(), rb.Dy())}
+}
+
+// originTrans is just like originTrans for a single image, except that the
+// origin is limited by the larger of the two images and the size of a pane.
+func (c *compare) originTrans(win *window, decoded []image.Image,
+	pt image.Point) image.Point {
+
+	pane, _ := c.panes(win)
+	size := c.size(decoded)
+	pt.X = max(0, min(pt.X, size.X-pane.Dx()))
+	pt.Y = max(0, min(pt.Y, size.Y-pane.Dy()))
+	return pt
+}
+
+// offset returns where (in window coordinates) the top-left corner of the
+// images is in pane. The images are centered in the pane when they fit.
+func (c *compare) offset(pane image.Rectangle, decoded []image.Image,
+	origin image.Point) image.Point {
+
+	size := c.size(decoded)
+	center := image.Point{
+		max(0, (pane.Dx()-size.X)/2), max(0, (pane.Dy()-size.Y)/2),
+	}
+	return pane.Min.Add(center).Sub(origin)
+}
+
+// draw paints images A and B according to the mode, and labels them with
+// their names. Images that haven't been loaded yet are skipped.
+// The difference in the diff mode is computed from the decoded images in a
+// new goroutine if it hasn't been already, and the canvas should call draw
+// again when it's sent on diffChan.
+func (c *compare) draw(win *window, imgs []*vimage, decoded []image.Image,
+	names []string, origin image.Point, diffChan chan *difference) {
+
+	win.nameSet(fmt.Sprintf("%s vs. %s", names[c.a], names[c.b]))
+	view, _ := c.panes(win)
+	switch c.mode {
+	case "flicker":
+		i, which := c.a, "A"
+		if c.showB {
+			i, which = c.b, "B"
+		}
+		c.drawPane(win, view, imgs[i], decoded, origin)
+		c.label(win, view, imgs[i] != nil, fmt.Sprintf("%s: %s [%d]",
+			which, names[i], i+1))
+	case "onion":
+		c.drawOnion(win, view, imgs[c.a], imgs[c.b], decoded, origin)
+		c.label(win, view, imgs[c.a] != nil && imgs[c.b] != nil,
+			fmt.Sprintf("%s [%d] over %s [%d] at %d%%",
+				names[c.b], c.b+1, names[c.a], c.a+1, c.opacity))
+	case "diff":
+		key := diffKey{c.a, c.b}
+		ready := c.diff != nil && c.diff.key == key
+		if !ready && (c.pending == nil || *c.pending != key) {
+			c.pending = &key
+			go newDifference(win.X, key, decoded[c.a], decoded[c.b],
+				diffChan)
+		}
+		var heat *vimage
+		if ready {
+			heat = c.diff.heat
+		}
+		c.drawPane(win, view, heat, decoded, origin)
+		c.label(win, view, ready, fmt.Sprintf("Difference of %s [%d] and "+
+			"%s [%d]", names[c.a], c.a+1, names[c.b], c.b+1))
+	default:
+		c.drawSplit(win, imgs, decoded, names, origin)
+	}
+}
+
+// loaded is called when a difference has been computed. It returns true if
+// the comparison needs to be drawn again.
+func (c *compare) loaded(diff *difference) bool {
+	if c.pending == nil || *c.pending != diff.key {
+		if diff.heat != nil {
+			diff.heat.Destroy()
+		}
+		return false
+	}
+	if c.diff != nil && c.diff.heat != nil {
+		c.diff.heat.Destroy()
+	}
+	c.diff, c.pending = diff, nil
+	return c.active && c.mode == "diff"
+}
+
+// forget throws away the difference computed from the image at index i,
+// since the image has changed.
+func (c *compare) forget(i int) {
+	if c.pending != nil && (c.pending.a == i || c.pending.b == i) {
+		c.pending = nil
+	}
+	if c.diff != nil && (c.diff.key.a == i || c.diff.key.b == i) {
+		if c.diff.heat != nil {
+			c.diff.heat.Destroy()
+		}
+		c.diff = nil
+	}
+}
+
+// clear throws away every difference, since the images may have moved
+// around in the list.
+func (c *compare) clear() {
+	c.pending = nil
+	if c.diff != nil && c.diff.heat != nil {
+		c.diff.heat.Destroy()
+	}
+	c.diff = nil
+}
+
+// stats returns the statistics of the difference between images A and B
+// for the information overlay, or nil if they aren't being shown.
+func (c *compare) stats() []string {
+	if !c.active || c.mode != "diff" || c.diff == nil ||
+		c.diff.key != (diffKey{c.a, c.b}) {
+		return nil
+	}
+	return c.diff.lines()
+}
+
+// label draws text in the bottom-left corner of pane. If the images in the
+// pane haven't been loaded yet, that is mentioned too.
+func (c *compare) label(win *window, pane image.Rectangle, loaded bool,
+	text string) {
+
+	if !loaded {
+		text += " - Loading..."
+	}
+	_, height := win.textSize([]string{text})
+	win.text(pane.Min.X, pane.Max.Y-height, []string{text})
+}
+
+// drawSplit paints images A and B into their panes, with the name of each
+// image in the bottom-left corner of its pane.
+func (c *compare) drawSplit(win *window, imgs []*vimage,
+	decoded []image.Image, names []string, origin image.Point) {
+
+	paneA, paneB := c.panes(win)
+	if c.stacked {
+		win.fill(image.Rect(0, paneA.Max.Y, paneA.Max.X, paneB.Min.Y),
+			0x000000)
+	} else {
+		win.fill(image.Rect(paneA.Max.X, 0, paneB.Min.X, paneA.Max.Y),
+			0x000000)
+	}
+	c.drawPane(win, paneA, imgs[c.a], decoded, origin)
+	c.drawPane(win, paneB, imgs[c.b], decoded, origin)
+
+	c.label(win, paneA, imgs[c.a] != nil,
+		fmt.Sprintf("%s [%d]", names[c.a], c.a+1))
+	c.label(win, paneB, imgs[c.b] != nil,
+		fmt.Sprintf("%s [%d]", names[c.b], c.b+1))
+}
+
+// drawPane paints the visible part of img into pane, and clears the rest of
+// the pane.
+func (c *compare) drawPane(win *window, pane image.Rectangle, img *vimage,
+	decoded []image.Image, origin image.Point) {
+
+	painted := image.Rectangle{}
+	if img != nil {
+		off := c.offset(pane, decoded, origin)
+		visible := img.Bounds().Intersect(pane.Sub(off))
+		if !visible.Empty() {
+			sub := img.SubImage(visible).(*xgraphics.Image)
+			painted = visible.Add(off)
+			sub.XExpPaint(win.Id, painted.Min.X, painted.Min.Y)
+		}
+	}
+	win.clearAround(pane, painted)
+}
+
+// drawOnion blends the visible part of image B over image A with the
+// current opacity, and paints the result into pane. The blending is done
+// with the converted images, so nothing has to be converted again. Where
+// only one of the images has pixels (because the other is smaller), the
+// window background is used in place of the missing image. Nothing is drawn
+// until both images have been loaded.
+func (c *compare) drawOnion(win *window, pane image.Rectangle, imgA,
+	imgB *vimage, decoded []image.Image, origin image.Point) {
+
+	if imgA == nil || imgB == nil {
+		win.clearAround(pane, image.Rectangle{})
+		return
+	}
+	off := c.offset(pane, decoded, origin)
+	visible := imgA.Bounds().Union(imgB.Bounds()).Intersect(pane.Sub(off))
+	if visible.Empty() {
+		win.clearAround(pane, image.Rectangle{})
+		return
+	}
+
+	blended := xgraphics.New(win.X, visible)
+	bg := flagBackground.bgra()
+	pixel := func(img *vimage, x, y int) xgraphics.BGRA {
+		if !image.Pt(x, y).In(img.Bounds()) {
+			return bg
+		}
+		return img.At(x, y).(xgraphics.BGRA)
+	}
+	blend := func(a, b uint8) uint8 {
+		return uint8((int(a)*(100-c.opacity) + int(b)*c.opacity) / 100)
+	}
+	for y := visible.Min.Y; y < visible.Max.Y; y++ {
+		for x := visible.Min.X; x < visible.Max.X; x++ {
+			a, b := pixel(imgA, x, y), pixel(imgB, x, y)
+			blended.SetBGRA(x, y, xgraphics.BGRA{
+				B: blend(a.B, b.B), G: blend(a.G, b.G), R: blend(a.R, b.R),
+				A: 0xff,
+			})
+		}
+	}
+	if err := blended.CreatePixmap(); err != nil {
+		errLg.Println(err)
+		return
+	}
+	defer blended.Destroy()
+
+	painted := visible.Add(off)
+	blended.XDraw()
+	blended.XExpPaint(win.Id, painted.Min.X, painted.Min.Y)
+	win.clearAround(pane, painted)
+}
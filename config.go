@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The configuration file is made up of lines, where each line is a directive
+// followed by its arguments, separated by whitespace. Blank lines and lines
+// starting with a '#' are ignored. The directives are:
+//
+//	bind KEY ACTION
+//		Bind the key sequence KEY (i.e., "shift-h") to the action named
+//		ACTION. This replaces any existing keybinding for KEY.
+//	unbind KEY
+//		Remove the keybinding for the key sequence KEY.
+//	bind-mouse BUTTON ACTION
+//		Bind the mouse button BUTTON (i.e., "3", "shift-4" or "double-1") to
+//		the action named ACTION. The special action "pan" pans the image
+//		while the button is held down.
+//	unbind-mouse BUTTON
+//		Remove the mouse binding for BUTTON.
+//	command NAME COMMAND
+//		Define a new action named NAME that runs the shell command COMMAND
+//		(the rest of the line) on the current image. COMMAND may contain
+//		the placeholders %f, %n, %d and %i. (See expandCommand.) The action
+//		can then be bound to keys like any other. If the command exits with
+//		status 10, the image is decoded again.
+//	move NAME DIR, copy NAME DIR
+//		Define a new action named NAME that moves (or copies) the file of
+//		the current image to the directory DIR (the rest of the line). A
+//		moved image is taken out of the list.
+//	set OPTION VALUE
+//		Set the command line flag OPTION (without any dashes) to VALUE.
+//		i.e., "set width 800" or "set auto-resize true". Flags given on the
+//		command line take priority.
+//
+// Run 'imgv --keybindings' to see the names of the actions that are bound
+// to keys, and 'imgv --help' to see the available options.
+
+// cmdlineFlags is the set of flags given on the command line. Options set in
+// the configuration file don't change these.
+var cmdlineFlags = make(map[string]bool)
+
+// keyModifiers is the set of modifiers that may be used in a key sequence.
+var keyModifiers = map[string]bool{
+	"shift": true, "lock": true, "control": true, "mod1": true,
+	"mod2": true, "mod3": true, "mod4": true, "mod5": true, "any": true,
+}
+
+// configPath returns the default location of the configuration file, which
+// is "$XDG_CONFIG_HOME/imgv/config".
+func configPath() string {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if len(config) == 0 {
+		config = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(config, "imgv", "config")
+}
+
+// loadConfig reads the configuration file fName and applies each directive
+// in it. It is not an error if the file doesn't exist, unless the file was
+// given on the command line. The first invalid line found is returned as an
+// error that includes its line number.
+func loadConfig(fName string) error {
+	file, err := os.Open(fName)
+	if os.IsNotExist(err) && !cmdlineFlags["config"] {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := configDirective(lineno, scanner.Text()); err != nil {
+			return fmt.Errorf("%s:%d: %s", fName, lineno, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// configDirective applies a single directive from the configuration file,
+// which is the line at lineno.
+func configDirective(lineno int, line string) error {
+	fields := strings.Fields(line)
+	directive, args := fields[0], fields[1:]
+	switch directive {
+	case "bind":
+		if len(args) != 2 {
+			return fmt.Errorf("'bind' expects a key and an action, "+
+				"but got '%s'.", strings.Join(args, " "))
+		}
+		if err := checkKey(args[0]); err != nil {
+			return err
+		}
+		if findAction(args[1]) == nil {
+			return fmt.Errorf("Unknown action '%s'. (Run 'imgv "+
+				"--keybindings' to see a list of actions.)", args[1])
+		}
+		unbindKey(args[0])
+		keybinds = append(keybinds,
+			keyb{key: args[0], action: args[1], line: lineno})
+	case "unbind":
+		if len(args) != 1 {
+			return fmt.Errorf("'unbind' expects a key, but got '%s'.",
+				strings.Join(args, " "))
+		}
+		if !unbindKey(args[0]) {
+			return fmt.Errorf("The key '%s' is not bound.", args[0])
+		}
+	case "bind-mouse":
+		if len(args) != 2 {
+			return fmt.Errorf("'bind-mouse' expects a button and an "+
+				"action, but got '%s'.", strings.Join(args, " "))
+		}
+		if err := checkButton(args[0]); err != nil {
+			return err
+		}
+		if args[1] != "pan" && findAction(args[1]) == nil {
+			return fmt.Errorf("Unknown action '%s'. (Run 'imgv "+
+				"--keybindings' to see a list of actions.)", args[1])
+		}
+		unbindButton(args[0])
+		mousebinds = append(mousebinds,
+			mouseb{button: args[0], action: args[1], line: lineno})
+	case "unbind-mouse":
+		if len(args) != 1 {
+			return fmt.Errorf("'unbind-mouse' expects a button, but got "+
+				"'%s'.", strings.Join(args, " "))
+		}
+		if !unbindButton(args[0]) {
+			return fmt.Errorf("The mouse button '%s' is not bound.", args[0])
+		}
+	case "command":
+		if len(args) < 2 {
+			return fmt.Errorf("'command' expects a name and a command, "+
+				"but got '%s'.", strings.Join(args, " "))
+		}
+		// The command is passed to the shell exactly as it was written.
+		if err := commandAction(args[0], fieldsRest(line, 2)); err != nil {
+			return err
+		}
+	case "move", "copy":
+		if len(args) < 2 {
+			return fmt.Errorf("'%s' expects a name and a directory, "+
+				"but got '%s'.", directive, strings.Join(args, " "))
+		}
+		// Directory names may contain any white space.
+		dir := fieldsRest(line, 2)
+		if err := fileAction(args[0], directive, dir); err != nil {
+			return err
+		}
+	case "set":
+		if len(args) < 2 {
+			return fmt.Errorf("'set' expects an option and a value, "+
+				"but got '%s'.", strings.Join(args, " "))
+		}
+		name, value := args[0], strings.Join(args[1:], " ")
+		if name == "config" || name == "no-config" {
+			return fmt.Errorf("The '%s' option can only be set on the "+
+				"command line.", name)
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("Unknown option '%s'. (Run 'imgv --help' "+
+				"to see a list of options.)", name)
+		}
+		if cmdlineFlags[name] {
+			return nil
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("Invalid value '%s' for option '%s': %s",
+				value, name, err)
+		}
+	default:
+		return fmt.Errorf("Unknown directive '%s'.", directive)
+	}
+	return nil
+}
+
+// fieldsRest returns what is left of line after its first n fields, without
+// the white space around it. (Unlike joining the fields again, the white
+// space inside of it is kept as it is.)
+func fieldsRest(line string, n int) string {
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		j := strings.IndexFunc(line, unicode.IsSpace)
+		if j == -1 {
+			return ""
+		}
+		line = line[j:]
+	}
+	return strings.TrimSpace(line)
+}
+
+// checkKey makes sure that a key sequence is well formed. (Whether the key
+// itself exists can only be checked once we're connected to X.)
+func checkKey(key string) error {
+	parts := strings.Split(key, "-")
+	for i, part := range parts {
+		switch {
+		case len(part) == 0:
+			return fmt.Errorf("Invalid key '%s'.", key)
+		case i < len(parts)-1 && !keyModifiers[strings.ToLower(part)]:
+			return fmt.Errorf("Invalid key '%s': unknown modifier '%s'.",
+				key, part)
+		}
+	}
+	return nil
+}
+
+// checkButton makes sure that a mouse button is well formed. A mouse button
+// is just like a key sequence, except that it may start with "double-" and
+// the button itself must be a number.
+func checkButton(button string) error {
+	if err := checkKey(strings.TrimPrefix(button, "double-")); err != nil {
+		return fmt.Errorf("Invalid mouse button '%s'.", button)
+	}
+	parts := strings.Split(button, "-")
+	n, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil || n < 1 || n > 255 {
+		return fmt.Errorf("Invalid mouse button '%s': '%s' is not a button "+
+			"number.", button, parts[len(parts)-1])
+	}
+	return nil
+}
+
+// unbindButton removes the mouse binding for button, and returns whether
+// there was one to remove.
+func unbindButton(button string) bool {
+	for i, mb := range mousebinds {
+		if strings.EqualFold(mb.button, button) {
+			mousebinds = append(mousebinds[:i], mousebinds[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// unbindKey removes the keybinding for the key sequence key, and returns
+// whether there was one to remove.
+func unbindKey(key string) bool {
+	for i, kb := range keybinds {
+		if strings.EqualFold(kb.key, key) {
+			keybinds = append(keybinds[:i], keybinds[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
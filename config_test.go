@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// saveBindings restores the keybindings, mouse bindings and actions when the
+// test is done, since configuration directives change them.
+func saveBindings(t *testing.T) {
+	keys := append([]keyb{}, keybinds...)
+	buttons := append([]mouseb{}, mousebinds...)
+	acts := append([]action{}, actions...)
+	t.Cleanup(func() {
+		keybinds, mousebinds, actions = keys, buttons, acts
+	})
+}
+
+func TestConfigDirectiveErrors(t *testing.T) {
+	saveBindings(t)
+	tests := []string{
+		"frobnicate",
+		"bind",
+		"bind x",
+		"bind x next-image extra",
+		"bind foo-x next-image",
+		"bind -x next-image",
+		"bind x no-such-action",
+		"unbind",
+		"unbind not-bound-key",
+		"bind-mouse 1",
+		"bind-mouse x next-image",
+		"bind-mouse 256 next-image",
+		"bind-mouse foo-1 next-image",
+		"bind-mouse 1 no-such-action",
+		"unbind-mouse 99",
+		"command",
+		"command name-only",
+		"command next-image echo %f",
+		"move",
+		"move name-only",
+		"copy next-image /tmp",
+		"set",
+		"set width",
+		"set no-such-option 1",
+		"set config /tmp/config",
+		"set width wide",
+	}
+	for _, line := range tests {
+		if err := configDirective(1, line); err == nil {
+			t.Errorf("configDirective(%q): expected an error", line)
+		}
+	}
+}
+
+func TestConfigDirective(t *testing.T) {
+	saveBindings(t)
+	tests := []struct {
+		line   string
+		action string
+	}{
+		{"bind control-x next-image", ""},
+		{"unbind control-x", ""},
+		{"bind-mouse double-shift-9 prev-image", ""},
+		{"bind-mouse 8 pan", ""},
+		{"unbind-mouse double-shift-9", ""},
+		{"command test-cmd  echo  %f   |  cat ", "Run 'echo  %f   |  cat'."},
+		{"move test-move /tmp/a  b", "Move the current image to '/tmp/a  b'."},
+		{"copy\ttest-copy\t/tmp", "Copy the current image to '/tmp'."},
+	}
+	for _, test := range tests {
+		if err := configDirective(1, test.line); err != nil {
+			t.Errorf("configDirective(%q): %s", test.line, err)
+			continue
+		}
+		if len(test.action) == 0 {
+			continue
+		}
+		name := strings.Fields(test.line)[1]
+		if act := findAction(name); act == nil {
+			t.Errorf("configDirective(%q): no action '%s'", test.line, name)
+		} else if act.desc != test.action {
+			t.Errorf("configDirective(%q): action is %q, want %q",
+				test.line, act.desc, test.action)
+		}
+	}
+}
+
+func TestLoadConfigLineNumbers(t *testing.T) {
+	saveBindings(t)
+	tests := []struct {
+		config string
+		lineno int
+	}{
+		{"frobnicate\n", 1},
+		{"# comment\n\n   \nbind x\n", 4},
+		{"bind x next-image\n\t# indented comment\nunbind y\n", 3},
+		{"bind x next-image\nunbind x\nunbind x\n", 3},
+		{"command a echo\ncommand a echo\n", 2},
+	}
+	for i, test := range tests {
+		fName := filepath.Join(t.TempDir(), fmt.Sprintf("config%d", i))
+		if err := os.WriteFile(fName, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := loadConfig(fName)
+		prefix := fmt.Sprintf("%s:%d: ", fName, test.lineno)
+		if err == nil {
+			t.Errorf("loadConfig(%q): expected an error", test.config)
+		} else if !strings.HasPrefix(err.Error(), prefix) {
+			t.Errorf("loadConfig(%q) = '%s', want an error starting "+
+				"with '%s'", test.config, err, prefix)
+		}
+	}
+}
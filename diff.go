@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xgraphics"
+)
+
+// mismatchColor is the color of the parts of the difference heatmap that
+// are only covered by one of the two images.
+var mismatchColor = xgraphics.BGRA{B: 0xff, G: 0x00, R: 0xff, A: 0xff}
+
+// diffKey identifies the two images (A and B) that a difference was
+// computed from.
+type diffKey struct {
+	a, b int
+}
+
+// difference is the per-pixel difference between two images, shown as a
+// heatmap, and some statistics about it.
+type difference struct {
+	key diffKey
+
+	// heat is the heatmap: the bigger the difference of a pixel, the
+	// brighter it is.
+	heat *vimage
+
+	// max is the biggest difference of any channel of any pixel, while
+	// mean is the average difference over every channel of every pixel.
+	// Only the pixels in both images are counted.
+	max  int
+	mean float64
+
+	// psnr is the peak signal-to-noise ratio (in dB), or +Inf if the images
+	// are identical.
+	psnr float64
+
+	// mismatch is true when the images aren't the same size.
+	mismatch bool
+}
+
+// newDifference is meant to be run as a goroutine and computes the
+// difference between the decoded images imgA and imgB (described by key).
+// The images are aligned at their top-left corners. The difference is sent
+// on diffChan when it's done.
+// The difference of each pixel is the biggest absolute difference of its
+// red, green, blue and alpha channels, multiplied by --diff-gain to make
+// small differences visible.
+func newDifference(X *xgbutil.XUtil, key diffKey, imgA, imgB image.Image,
+	diffChan chan *difference) {
+
+	start := time.Now()
+	imgA, imgB = pixels(imgA), pixels(imgB)
+	ra, rb := imgA.Bounds(), imgB.Bounds()
+	size := image.Rect(0, 0, max(ra.Dx(), rb.Dx()), max(ra.Dy(), rb.Dy()))
+	both := image.Rect(0, 0, min(ra.Dx(), rb.Dx()), min(ra.Dy(), rb.Dy()))
+	diff := &difference{key: key, mismatch: ra.Size() != rb.Size()}
+
+	heat := xgraphics.New(X, size)
+	var sum, sumSquares float64
+	for y := 0; y < size.Dy(); y++ {
+		for x := 0; x < size.Dx(); x++ {
+			pt := image.Pt(x, y)
+			if !pt.In(both) {
+				if pt.Add(ra.Min).In(ra) || pt.Add(rb.Min).In(rb) {
+					heat.SetBGRA(x, y, mismatchColor)
+				} else {
+					heat.SetBGRA(x, y, flagBackground.bgra())
+				}
+				continue
+			}
+
+			ca := color.NRGBAModel.Convert(
+				imgA.At(ra.Min.X+x, ra.Min.Y+y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(
+				imgB.At(rb.Min.X+x, rb.Min.Y+y)).(color.NRGBA)
+			most := 0
+			for _, d := range []int{
+				abs(int(ca.R) - int(cb.R)), abs(int(ca.G) - int(cb.G)),
+				abs(int(ca.B) - int(cb.B)), abs(int(ca.A) - int(cb.A)),
+			} {
+				most = max(most, d)
+				sum += float64(d)
+				sumSquares += float64(d * d)
+			}
+			diff.max = max(diff.max, most)
+			heat.SetBGRA(x, y, heatColor(min(255, most*flagDiffGain)))
+		}
+	}
+
+	samples := float64(4 * both.Dx() * both.Dy())
+	if samples > 0 {
+		diff.mean = sum / samples
+	}
+	if mse := sumSquares / math.Max(1, samples); mse == 0 {
+		diff.psnr = math.Inf(1)
+	} else {
+		diff.psnr = 10 * math.Log10(255*255/mse)
+	}
+
+	if err := heat.CreatePixmap(); err != nil {
+		errLg.Println(err)
+	} else {
+		heat.XDraw()
+		diff.heat = &vimage{Image: heat, name: "difference"}
+	}
+	lg("Computed the difference of images %d and %d (%s).",
+		key.a, key.b, time.Since(start))
+
+	diffChan <- diff
+}
+
+// heatColor maps v (from 0 to 255) to a color that goes from black through
+// red and yellow to white.
+func heatColor(v int) xgraphics.BGRA {
+	switch {
+	case v < 85:
+		return xgraphics.BGRA{R: uint8(v * 3), A: 0xff}
+	case v < 170:
+		return xgraphics.BGRA{R: 0xff, G: uint8((v - 85) * 3), A: 0xff}
+	default:
+		return xgraphics.BGRA{
+			B: uint8(min(255, (v-170)*3)), G: 0xff, R: 0xff, A: 0xff,
+		}
+	}
+}
+
+// lines returns the statistics of the difference as lines of text for the
+// information overlay.
+func (d *difference) lines() []string {
+	psnr := "infinite (identical)"
+	if !math.IsInf(d.psnr, 1) {
+		psnr = fmt.Sprintf("%.2f dB", d.psnr)
+	}
+	lines := []string{
+		fmt.Sprintf("Max error: %d", d.max),
+		fmt.Sprintf("Mean error: %.3f", d.mean),
+		fmt.Sprintf("PSNR: %s", psnr),
+	}
+	if d.mismatch {
+		lines = append(lines, "Sizes differ (mismatch in magenta)")
+	}
+	return lines
+}
@@ -14,12 +14,77 @@ The flags are:
 	--auto-resize
 		If set, the image window will be automatically resized to the first 
 		image displayed. This overrides the 'height' and 'width' options.
+	--resize-each
+		If set, the image window will be resized to every image as it is
+		displayed, rather than only the first. Images that are bigger than
+		the work area of the monitor are scaled down to fit in it. This can
+		be toggled with 'R'.
+	--resize-anchor top-left|center
+		Whether the top-left corner (the default) or the center of the
+		window stays in place when the window is resized to an image.
+	--monitor number
+		The monitor (as numbered by Xinerama, starting from 0) that the
+		window is first shown on. The window is centered on that monitor.
 	--increment pixels
 		The amount of pixels to pan an image at each step when using the 
 		keyboard shortcuts.
 	--keybindings
 		If set, a list of all key bindings (and mouse bindings) set by imgv is
 		printed. A small description of what each key binding does is included.
+		The name of each action is included too, so that it can be bound to a
+		different key in the configuration file.
+	--config file-name
+		The configuration file to read. By default, this is
+		$XDG_CONFIG_HOME/imgv/config.
+	--no-config
+		If set, the configuration file is not read.
+	--class name
+		The class name of the window (in WM_CLASS), so that window manager
+		rules can be made for imgv. By default, this is "Imgv". The instance
+		name is always "imgv".
+	--background color
+		The background color (in #rrggbb format) of the window around the
+		image. By default, this is white.
+	--backdrop checker|solid|black
+		What images with transparent pixels are shown on top of. By default,
+		this is a checkerboard. It can be changed while imgv is running by
+		pressing 'b'.
+	--backdrop-color color
+		The color of the 'solid' backdrop. By default, this is grey.
+	--checker-light color, --checker-dark color
+		The colors of the squares in the 'checker' backdrop.
+	--checker-size pixels
+		The size of the squares in the 'checker' backdrop.
+	--diff-gain number
+		The amount that differences between pixels are multiplied by in the
+		difference heatmap, so that small differences can be seen.
+	--flicker-interval milliseconds
+		The time between switching images when flickering between two images
+		on a timer. By default, this is 500 milliseconds.
+	--fullscreen
+		If set, the window starts in fullscreen mode.
+	--fullscreen-bg color
+		The background color (in #rrggbb format) around the image in
+		fullscreen mode. By default, this is black.
+	--socket file-name
+		If set, imgv listens for commands on the Unix domain socket
+		file-name. (See "Remote control" below.)
+	--remote
+		If set, the arguments are sent as a command to the imgv that is
+		listening on the socket given by --socket, instead of being opened.
+		Replies are printed to stdout. Without --socket, the command is sent
+		to the imgv started with --single-instance on the same display.
+	--single-instance
+		If set, and another imgv started with --single-instance is running
+		on the same X display, the images are added to that imgv's list
+		(which shows the first of them) and this imgv quits. The imgvs talk
+		through the socket $XDG_RUNTIME_DIR/imgv-$DISPLAY.sock, unless
+		--socket is given. Without $XDG_RUNTIME_DIR, the socket is in
+		/tmp/imgv-UID, which must be owned by the user with mode 0700.
+	--null
+		If set, the file names of the marked images that are printed when
+		imgv quits are separated by NUL bytes instead of newlines. (For
+		'xargs -0'.)
 	-v
 		If set, more output will be printed to stderr. Useful for debugging.
 	--profile prof-file-name
@@ -30,7 +95,104 @@ Details
 
 imgv is about as simple as it gets for an image viewer. It only supports
 displaying the image and panning around the image when parts of it are not
-viewable. It does not support zooming or any kind of image manipulation.
+viewable. It does not support zooming (other than scaling images down to fit 
+the screen with --resize-each) or any kind of image manipulation.
+
+Pressing 'g' switches to a grid of thumbnails of every image. The selection
+can be moved with the same keys used for panning and cycling, and pressing
+Enter (or clicking on a thumbnail) shows that image. Thumbnails are generated
+one at a time in the background, separately from the full image conversions
+described below. They are shared with file managers through the freedesktop.org
+thumbnail cache in $XDG_CACHE_HOME/thumbnails, so they only need to be
+generated again when an image file is modified.
+
+Pressing 'f' toggles a filmstrip along the bottom of the window, which shows
+small thumbnails of the images surrounding the current one. Clicking on a
+thumbnail in the filmstrip shows that image.
+
+Pressing 'i' toggles an overlay with information about the current image: its
+file name, position in the list, dimensions, format, color model, file size
+and (for JPEG files) a few EXIF fields like the camera and exposure.
+
+Pressing 'p' toggles the pixel inspector, which shows the coordinates and
+color of the pixel under the mouse pointer. The color is read from the
+decoded image, before it is blended into the checkered background. Pressing
+'c' copies that color to the clipboard.
+
+Pressing 's' toggles a histogram of the red, green, blue and luma channels of
+the current image, and 'S' switches the histogram between the whole image and
+only the part of the image that is visible. Histograms are computed in the
+background from the decoded image.
+
+Pressing 'a' cycles through ways of showing the alpha channel: blended into
+the backdrop (the default), the alpha channel alone in grayscale (where white
+is opaque), blended with fully transparent pixels tinted magenta, and the
+straight and premultiplied colors without any transparency. The information
+overlay shows the current alpha mode.
+
+Pressing 'v' compares the current image (A) with the next image (B) by
+showing them side by side, and 'V' stacks them on top of each other instead.
+Both images are aligned at their top-left corners and pan together, as far as
+the larger of the two allows. Cycling through images changes image B (as does
+clicking on the filmstrip), and 'w' swaps the two images.
+
+Pressing 'm' while comparing switches between the side by side mode, a
+flicker mode and an onion skin mode. The flicker mode shows image A in the
+whole window, and holding down space shows image B (at exactly the same
+position) until space is released. Pressing 't' switches between them on a
+timer instead, until the flicker mode is left. The onion
+skin mode blends image B over image A, and '=' and '-' make image B more or
+less opaque. Switching and blending uses the converted images, so nothing has
+to be converted again.
+
+The last comparison mode shows the difference between the two images as a
+heatmap, where the difference of each pixel is the biggest difference of any
+of its channels (including alpha), amplified by --diff-gain. The information
+overlay shows the biggest and mean difference (over every channel) and the
+PSNR. Images of different sizes are aligned at their top-left corners, and
+the parts that are only covered by one image are shown in magenta.
+
+Pressing 'x' marks (or unmarks) the current image, or the image selected in
+the thumbnail grid. Marked images say so in their bottom-right corner, and
+have an orange marker in the grid. 'Control-a' marks every image,
+'Control-Shift-a' unmarks every image and 'X' inverts the marks. When imgv
+quits, the absolute file names of the marked images are printed to stdout,
+one per line, so that imgv can be used to sort through images. Nothing else is
+printed to stdout:
+
+	imgv *.jpg | xargs mv -t keep/
+
+Pressing Delete moves the current image (or the image selected in the
+thumbnail grid) to the trash in $XDG_DATA_HOME/Trash, and takes it out of the
+list. The image after it is shown in its place. Pressing 'u' restores the
+image moved to the trash last, and puts it back in the list. Actions that move
+or copy images to other directories can be defined in the configuration file.
+(See below.) Moved images are taken out of the list too.
+
+Pressing F2 opens a prompt at the bottom of the window to rename the file of
+the current image (or the image selected in the thumbnail grid), which starts
+out with the current name. The usual keys for editing a line of text work
+(Left, Right, Home, End, BackSpace, Delete, Control-a, Control-e, Control-u and
+Control-k), and none of the keybindings or mouse bindings do until the prompt
+is closed. Return renames the file and Escape leaves it alone. The file stays
+in the same directory, and existing files are never replaced.
+
+Pressing 'F' (or double clicking) toggles fullscreen mode, where the image is
+centered on a plain background. If the window manager supports EWMH, it is
+asked to make the window fullscreen. Otherwise, imgv covers the screen itself
+and grabs the keyboard until fullscreen mode is left. Either way, only the
+monitor that the window is on is covered.
+
+imgv asks the window manager to keep the window at the aspect ratio of the
+current image (except in the thumbnail grid and the comparison mode), and sets
+the window's icon to a thumbnail of the current image.
+
+The window is never made bigger than the work area of the monitor it is on,
+whether its size comes from the 'height' and 'width' options or from resizing
+it to fit an image. When the window is resized to every image, an image that
+is bigger than the work area is scaled down to fit in it. (The comparison mode
+always shows images at their full size.) Otherwise, such an image is shown at
+its full size and can be panned as usual.
 
 My two primary future goals are to support zooming and to increase 
 performance.  (I'll rely on the Go standard library to write new image format 
@@ -40,16 +202,126 @@ I didn't include zooming in the initial release because it adds a surprising
 amount of complexity and has broad-sweeping performance implications depending 
 upon its implementation.
 
+Configuration
+
+Keybindings, mouse bindings and flags can be changed in the configuration
+file at $XDG_CONFIG_HOME/imgv/config (usually ~/.config/imgv/config). Each line
+is either blank, a comment starting with '#', or a directive:
+
+	bind KEY ACTION
+		Bind the key sequence KEY (i.e., "shift-h") to the action named
+		ACTION. This replaces any existing keybinding for KEY.
+	unbind KEY
+		Remove the keybinding for the key sequence KEY.
+	bind-mouse BUTTON ACTION
+		Bind the mouse button BUTTON (i.e., "3", "shift-4" or "double-1") to
+		the action named ACTION. The special action "pan" pans the image
+		while the button is held down.
+	unbind-mouse BUTTON
+		Remove the mouse binding for BUTTON.
+	command NAME COMMAND
+		Define a new action named NAME that runs the shell command COMMAND
+		(the rest of the line) on the current image. The action can then be
+		bound like any other.
+	move NAME DIR, copy NAME DIR
+		Define a new action named NAME that moves (or copies) the file of
+		the current image to the directory DIR (the rest of the line).
+	set OPTION VALUE
+		Set the flag OPTION (without any dashes) to VALUE. Flags given on
+		the command line take priority over options set this way.
+
+For example:
+
+	# Use the space bar to go to the next image.
+	bind space next-image
+
+	# Use the scroll wheel to pan instead of cycling through images.
+	bind-mouse 4 pan-up
+	bind-mouse 5 pan-down
+
+	# Always start with a bigger window.
+	set width 1024
+	set height 768
+
+	# Open the current image in GIMP with 'e'.
+	command edit gimp %f
+	bind e edit
+
+	# Sort images into ~/keep with '1' and ~/maybe with '2'.
+	move keep ~/keep
+	bind 1 keep
+	move maybe ~/maybe
+	bind 2 maybe
+
+In commands, %f is replaced with the absolute file name of the current image
+(or the image selected in the thumbnail grid), %n with its base name, %d with
+the directory it is in, %i with its number in the list and %% with a '%'. File
+names are quoted for the shell, so they shouldn't be quoted again. Commands
+run in the background, and all of their output goes to imgv's stderr, since
+stdout only has the marked images. (See above.) If a command exits with status
+10, imgv decodes the image again, so a command that edits the image file can
+show the result.
+
+Remote control
+
+When imgv is started with --socket, it listens for commands on that Unix
+domain socket, one per line. imgv replies to each one with a line that is
+either "ok" (possibly followed by some data) or "error" followed by a message.
+The commands are:
+
+	next, prev
+		Show the next or previous image.
+	goto N
+		Show image N. (The first image is 1.)
+	open FILE
+		Add FILE (an absolute file name) to the list of images and show it.
+	add FILE
+		Add FILE (an absolute file name) to the list of images.
+	current
+		Reply with the number of the current image, the number of images and
+		the file name of the current image.
+	raise
+		Ask the window manager to raise and focus the window.
+	action NAME
+		Run the action named NAME, as listed by --keybindings.
+	zoom [fit|full|toggle]
+		Scale images down to fit in the work area ("fit"), show them at
+		full size ("full") or switch between the two, like --resize-each.
+		The window follows the size of each image when they are scaled.
+		Reply with "fit" or "full".
+	quit
+		Quit.
+
+'imgv --socket file-name --remote command' sends a command and prints the
+reply. For example:
+
+	imgv --socket /tmp/imgv.sock --remote next
+	imgv --socket /tmp/imgv.sock --remote open ~/a.png ~/b.png
+
+With 'open', file names are made absolute first, and only the first file is
+shown.
+
+The same commands can be sent without a socket, as a ClientMessage event of
+type _IMGV_COMMAND sent to imgv's window. With format 8, the data is the
+command itself (at most 20 bytes). With format 32, the first value is an atom
+whose name is the command. Nothing is replied, but imgv keeps the absolute
+file name and the number of the image being shown in the _IMGV_CURRENT_FILE
+and _IMGV_INDEX properties of its window. For example:
+
+	xprop -id $(xdotool search --classname imgv) _IMGV_CURRENT_FILE
+
 High-level overview
 
-imgv starts up by attempting to decode all images specified on the command 
-line. After all images are decoded, the first image is converted to an 
-xgbutil/xgraphics.Image type and drawn on to an X pixmap. At this point, the 
-first image is then painted to the window.
+imgv starts up by reading the header of every image specified on the command 
+line, which tells it the size of each image without decoding it. The first 
+image is then decoded, converted to an xgbutil/xgraphics.Image type and drawn 
+on to an X pixmap. At this point, the first image is then painted to the 
+window. Thumbnails are read from the thumbnail cache in the background, and 
+only images without a cached thumbnail are decoded to generate one.
 
-When the next image is requested to be displayed, it is then converted to an
-xgbutil/xgraphics.Image type and drawn to an X pixmap on demand. Then it is 
-painted to the window.
+When the next image is requested to be displayed, it is then decoded, 
+converted to an xgbutil/xgraphics.Image type and drawn to an X pixmap on 
+demand. Then it is painted to the window.
 
 Performance
 
@@ -57,18 +329,16 @@ It has a somewhat concurrent design, and will benefit from parallelism
 (particularly at startup). Also, the underlying library used (XGB) benefits 
 from parallelism.
 
-The high-level overview given above may sound a bit weird (i.e., why decode all 
-images before showing the first?). My reason is that this was the quickest and 
-simplest way to get something working, since decoding an image has a reasonable 
-chance of failure. (There is additional complexity involved in handling failure 
-at the concurrent level.) Decoding will take advantage of parallelism and is 
-typically fairly quick (unless a lot of images are specified).
+Reading the headers of the images at startup takes advantage of parallelism 
+and is quick, even when a lot of images are specified. An image file that 
+can't be read (or isn't in a supported format) is skipped at this point. 
+Decoding is done on demand, when an image is converted for the first time.
 
 Perhaps the biggest performance implication is what is done on-demand when a 
 new image must be loaded. If it has already been converted and painted to an X 
 pixmap, this process is nearly instant. If its the first loading, then it must 
-be converted to an xgbutil/xgraphics.Image type and drawn to an X pixmap before 
-it can be painted to a window.
+be decoded, converted to an xgbutil/xgraphics.Image type and drawn to an X 
+pixmap before it can be painted to a window.
 
 Conversion to the xgbutil/xgraphics.Image type is, by far, the bottleneck. The 
 process includes transforming every pixel in the decoded image to the correct 
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// EXIF tags that we care about. IFD0 contains the camera, and the EXIF
+// sub-IFD (pointed to by exifTagExifIFD) contains everything else.
+const (
+	exifTagMake         = 0x010f
+	exifTagModel        = 0x0110
+	exifTagDateTime     = 0x0132
+	exifTagExifIFD      = 0x8769
+	exifTagExposureTime = 0x829a
+	exifTagFNumber      = 0x829d
+	exifTagISO          = 0x8827
+	exifTagDateOriginal = 0x9003
+	exifTagFocalLength  = 0x920a
+)
+
+// exifTypeSizes maps TIFF field types to the size of a single value.
+// Types not in this map are ignored.
+var exifTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8,
+}
+
+// exifInfo contains a few human readable fields from an image's EXIF data.
+// Any field may be empty.
+type exifInfo struct {
+	camera   string
+	exposure string
+	date     string
+}
+
+// exifField is a single field from a TIFF IFD. data contains all of its
+// values in the TIFF's byte order.
+type exifField struct {
+	typ  uint16
+	data []byte
+}
+
+// readExif reads the EXIF data from the JPEG file fName. An error is returned
+// if the file isn't a JPEG file or if it doesn't have any EXIF data.
+func readExif(fName string) (exifInfo, error) {
+	file, err := os.Open(fName)
+	if err != nil {
+		return exifInfo{}, err
+	}
+	defer file.Close()
+
+	tiff, err := jpegExif(bufio.NewReader(file))
+	if err != nil {
+		return exifInfo{}, err
+	}
+	fields, order, err := exifFields(tiff)
+	if err != nil {
+		return exifInfo{}, err
+	}
+
+	str := func(tag uint16) string {
+		if f, ok := fields[tag]; ok && f.typ == 2 {
+			return strings.TrimSpace(strings.TrimRight(string(f.data), "\x00"))
+		}
+		return ""
+	}
+	rational := func(tag uint16) (float64, bool) {
+		f, ok := fields[tag]
+		if !ok || (f.typ != 5 && f.typ != 10) || len(f.data) < 8 {
+			return 0, false
+		}
+		num, den := order.Uint32(f.data), order.Uint32(f.data[4:])
+		if den == 0 {
+			return 0, false
+		}
+		if f.typ == 10 {
+			return float64(int32(num)) / float64(int32(den)), true
+		}
+		return float64(num) / float64(den), true
+	}
+
+	info := exifInfo{}
+
+	// Camera models often repeat the make. (i.e., "Canon" "Canon EOS 5D".)
+	mk, model := str(exifTagMake), str(exifTagModel)
+	if strings.HasPrefix(strings.ToLower(model), strings.ToLower(mk)) {
+		info.camera = model
+	} else {
+		info.camera = strings.TrimSpace(mk + " " + model)
+	}
+
+	exposure := []string{}
+	if t, ok := rational(exifTagExposureTime); ok && t > 0 {
+		if t < 1 {
+			exposure = append(exposure, fmt.Sprintf("1/%.0fs", 1/t))
+		} else {
+			exposure = append(exposure, fmt.Sprintf("%gs", t))
+		}
+	}
+	if fnum, ok := rational(exifTagFNumber); ok && fnum > 0 {
+		exposure = append(exposure, fmt.Sprintf("f/%g", fnum))
+	}
+	if f, ok := fields[exifTagISO]; ok && f.typ == 3 && len(f.data) >= 2 {
+		exposure = append(exposure,
+			fmt.Sprintf("ISO %d", order.Uint16(f.data)))
+	}
+	if focal, ok := rational(exifTagFocalLength); ok && focal > 0 {
+		exposure = append(exposure, fmt.Sprintf("%gmm", focal))
+	}
+	info.exposure = strings.Join(exposure, ", ")
+
+	if info.date = str(exifTagDateOriginal); len(info.date) == 0 {
+		info.date = str(exifTagDateTime)
+	}
+	return info, nil
+}
+
+// jpegExif scans the markers of a JPEG file for an APP1 segment with EXIF
+// data, and returns the TIFF structure inside of it.
+func jpegExif(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return nil, err
+	}
+	if soi != [2]byte{0xff, 0xd8} {
+		return nil, errors.New("Not a JPEG file.")
+	}
+
+	for {
+		// Markers may be preceded by any number of 0xff fill bytes.
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != 0xff {
+			return nil, errors.New("Invalid JPEG marker.")
+		}
+		marker := byte(0xff)
+		for marker == 0xff {
+			if marker, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+
+		// EXIF data always comes before the image data.
+		if marker == 0xda || marker == 0xd9 {
+			return nil, errors.New("No EXIF data.")
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(size[:])) - 2
+		if length < 0 {
+			return nil, errors.New("Invalid JPEG segment length.")
+		}
+		if marker != 0xe1 {
+			if _, err := r.Discard(length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// exifFields reads all of the fields in IFD0 and the EXIF sub-IFD of a TIFF
+// structure. The byte order of the TIFF is returned too, since it is needed
+// to read the values of each field.
+func exifFields(tiff []byte) (map[uint16]exifField, binary.ByteOrder,
+	error) {
+
+	if len(tiff) < 8 {
+		return nil, nil, errors.New("EXIF data is too short.")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, nil, errors.New("Invalid TIFF byte order.")
+	}
+
+	fields := make(map[uint16]exifField)
+	readIFD := func(offset uint32) {
+		if int64(offset)+2 > int64(len(tiff)) {
+			return
+		}
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			entry := int(offset) + 2 + i*12
+			if entry+12 > len(tiff) {
+				return
+			}
+			tag := order.Uint16(tiff[entry:])
+			typ := order.Uint16(tiff[entry+2:])
+			size, ok := exifTypeSizes[typ]
+			if !ok {
+				continue
+			}
+			n := int64(order.Uint32(tiff[entry+4:])) * int64(size)
+
+			// Values that fit in four bytes are stored in the entry itself.
+			start := int64(entry + 8)
+			if n > 4 {
+				start = int64(order.Uint32(tiff[entry+8:]))
+			}
+			if start+n > int64(len(tiff)) {
+				continue
+			}
+			fields[tag] = exifField{typ, tiff[start : start+n]}
+		}
+	}
+
+	readIFD(order.Uint32(tiff[4:]))
+	if f, ok := fields[exifTagExifIFD]; ok && len(f.data) >= 4 {
+		readIFD(order.Uint32(f.data))
+	}
+	return fields, order, nil
+}
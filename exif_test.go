@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// exifEntry is a single IFD entry used to build test TIFF data. If value is
+// nil, offset is stored in the entry instead. (i.e., for a sub-IFD, or for
+// a value stored outside of the entry.)
+type exifEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+	offset   uint32
+}
+
+// testTIFF returns little endian TIFF data with IFD0 at offset 8 containing
+// entries, followed by extra.
+func testTIFF(entries []exifEntry, extra []byte) []byte {
+	order := binary.LittleEndian
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+	tiff = append(tiff, 0, 0)
+	order.PutUint16(tiff[8:], uint16(len(entries)))
+	for _, e := range entries {
+		var entry [12]byte
+		order.PutUint16(entry[0:], e.tag)
+		order.PutUint16(entry[2:], e.typ)
+		order.PutUint32(entry[4:], e.count)
+		if e.value != nil {
+			copy(entry[8:], e.value)
+		} else {
+			order.PutUint32(entry[8:], e.offset)
+		}
+		tiff = append(tiff, entry[:]...)
+	}
+	return append(tiff, extra...)
+}
+
+// testJPEG wraps the TIFF data in an EXIF APP1 segment, preceded by a
+// JFIF APP0 segment and followed by the start of the image data.
+func testJPEG(tiff []byte) []byte {
+	segment := func(marker byte, data []byte) []byte {
+		var header [4]byte
+		header[0], header[1] = 0xff, marker
+		binary.BigEndian.PutUint16(header[2:], uint16(len(data)+2))
+		return append(header[:], data...)
+	}
+	jpeg := []byte{0xff, 0xd8}
+	jpeg = append(jpeg, segment(0xe0, []byte("JFIF\x00\x01\x02"))...)
+	jpeg = append(jpeg, segment(0xe1, append([]byte("Exif\x00\x00"),
+		tiff...))...)
+	return append(jpeg, 0xff, 0xda)
+}
+
+func TestJpegExif(t *testing.T) {
+	tiff := testTIFF(nil, nil)
+	valid := testJPEG(tiff)
+
+	// The offset of the EXIF segment's length. (SOI and the JFIF segment
+	// come first.)
+	app1 := 2 + 2 + 2 + 7 + 2
+
+	badLength := append([]byte{}, valid...)
+	badLength[app1], badLength[app1+1] = 0, 1
+
+	fill := append([]byte{0xff, 0xd8, 0xff, 0xff}, valid[3:]...)
+
+	otherApp1 := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, 6, 'X', 'M', 'P',
+		0}, valid[2:]...)
+
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"valid", valid, true},
+		{"fill bytes", fill, true},
+		{"other APP1 first", otherApp1, true},
+		{"empty", nil, false},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), false},
+		{"SOI only", valid[:2], false},
+		{"invalid marker", []byte{0xff, 0xd8, 0x00, 0xe1}, false},
+		{"truncated length", valid[:app1+1], false},
+		{"invalid length", badLength, false},
+		{"truncated segment", valid[:app1+10], false},
+		{"truncated other segment", valid[:app1-3], false},
+		{"no EXIF", []byte{0xff, 0xd8, 0xff, 0xda}, false},
+		{"end of image", []byte{0xff, 0xd8, 0xff, 0xd9}, false},
+	}
+	for _, test := range tests {
+		r := bufio.NewReader(bytes.NewReader(test.data))
+		got, err := jpegExif(r)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("jpegExif(%s): %s", test.name, err)
+		case test.ok && !bytes.Equal(got, tiff):
+			t.Errorf("jpegExif(%s) = %q, want %q", test.name, got, tiff)
+		case !test.ok && err == nil:
+			t.Errorf("jpegExif(%s): expected an error", test.name)
+		}
+	}
+}
+
+func TestExifFieldsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tiff []byte
+	}{
+		{"empty", nil},
+		{"too short", []byte("II\x2a\x00\x08\x00\x00")},
+		{"invalid byte order", []byte("XX\x2a\x00\x08\x00\x00\x00\x00\x00")},
+	}
+	for _, test := range tests {
+		if _, _, err := exifFields(test.tiff); err == nil {
+			t.Errorf("exifFields(%s): expected an error", test.name)
+		}
+	}
+}
+
+func TestExifFields(t *testing.T) {
+	model := []byte("Camera\x00")
+	withModel := func(offset uint32) []exifEntry {
+		return []exifEntry{{exifTagModel, 2, 7, nil, offset}}
+	}
+
+	// IFD0 with a single entry ends at offset 8+2+12 = 22.
+	const end = 22
+
+	// A sub-IFD at end, containing an ISO field.
+	sub := make([]byte, 14)
+	binary.LittleEndian.PutUint16(sub, 1)
+	binary.LittleEndian.PutUint16(sub[2:], exifTagISO)
+	binary.LittleEndian.PutUint16(sub[4:], 3)
+	binary.LittleEndian.PutUint32(sub[6:], 1)
+	binary.LittleEndian.PutUint16(sub[10:], 400)
+
+	truncatedIFD0 := testTIFF(withModel(end), model)[:end-4]
+	binary.LittleEndian.PutUint16(truncatedIFD0[8:], 2)
+
+	tests := []struct {
+		name string
+		tiff []byte
+		tags []uint16
+	}{
+		{"no entries", testTIFF(nil, nil), nil},
+		{"value in entry", testTIFF([]exifEntry{
+			{exifTagISO, 3, 1, []byte{100, 0}, 0},
+		}, nil), []uint16{exifTagISO}},
+		{"value after IFD", testTIFF(withModel(end), model),
+			[]uint16{exifTagModel}},
+		{"value out of range", testTIFF(withModel(end+1), model), nil},
+		{"value offset too big", testTIFF(withModel(0xffffffff), model),
+			nil},
+		{"huge count", testTIFF([]exifEntry{
+			{exifTagModel, 2, 0xffffffff, nil, end},
+		}, model), nil},
+		{"unknown type", testTIFF([]exifEntry{
+			{exifTagModel, 42, 1, []byte{1}, 0},
+		}, nil), nil},
+		{"truncated IFD", truncatedIFD0, nil},
+		{"IFD0 out of range",
+			[]byte("II\x2a\x00\xff\xff\xff\xff\x00\x00"), nil},
+		{"sub-IFD", testTIFF([]exifEntry{
+			{exifTagExifIFD, 4, 1, nil, end},
+		}, sub), []uint16{exifTagExifIFD, exifTagISO}},
+		{"sub-IFD out of range", testTIFF([]exifEntry{
+			{exifTagExifIFD, 4, 1, nil, end + 13},
+		}, sub), []uint16{exifTagExifIFD}},
+		{"sub-IFD offset too big", testTIFF([]exifEntry{
+			{exifTagExifIFD, 4, 1, nil, 0xffffffff},
+		}, nil), []uint16{exifTagExifIFD}},
+	}
+	for _, test := range tests {
+		fields, _, err := exifFields(test.tiff)
+		if err != nil {
+			t.Errorf("exifFields(%s): %s", test.name, err)
+			continue
+		}
+		if len(fields) != len(test.tags) {
+			t.Errorf("exifFields(%s): got %d fields, want %d",
+				test.name, len(fields), len(test.tags))
+		}
+		for _, tag := range test.tags {
+			if _, ok := fields[tag]; !ok {
+				t.Errorf("exifFields(%s): no field %#x", test.name, tag)
+			}
+		}
+	}
+
+	fields, _, _ := exifFields(testTIFF(withModel(end), model))
+	if got := fields[exifTagModel].data; !bytes.Equal(got, model) {
+		t.Errorf("exifFields: model is %q, want %q", got, model)
+	}
+	fields, order, _ := exifFields(testTIFF([]exifEntry{
+		{exifTagExifIFD, 4, 1, nil, end},
+	}, sub))
+	if iso := order.Uint16(fields[exifTagISO].data); iso != 400 {
+		t.Errorf("exifFields: ISO is %d, want 400", iso)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fileOp is an operation on the file of the current image:
+//
+//	trash: move the file to the trash. (See trashFile.)
+//	undo: restore the file that was trashed last.
+//	move: move the file to dir.
+//	copy: copy the file to dir.
+//
+// The file of an image that is trashed or moved is taken out of the list.
+type fileOp struct {
+	kind string
+	dir  string
+}
+
+// fileDone is sent to the canvas when a file operation has finished. The
+// image is identified by its decoded image, since the list may have changed
+// while the operation was running. If the operation failed, err is set.
+type fileDone struct {
+	op      fileOp
+	decoded image.Image
+	err     error
+
+	// trashed describes the image that was trashed (or restored).
+	trashed *trashed
+}
+
+// renamed is sent to the canvas when a new name (without a directory) has
+// been entered for the file of the image decoded as decoded.
+type renamed struct {
+	decoded image.Image
+	name    string
+}
+
+// trashed is an image whose file was moved to the trash, and can be put
+// back into the list (at index) by undoing. The decoded image is kept, so
+// that it doesn't need to be decoded again.
+type trashed struct {
+	index   int
+	info    imgInfo
+	decoded image.Image
+
+	// trashName is the file in the trash, and infoName is the file that
+	// describes it. (See trashFile.)
+	trashName, infoName string
+}
+
+// fileAction defines a new action called name that moves or copies (kind)
+// the file of the current image to dir. It is an error if there's already an
+// action called name. A dir that starts with "~/" is in the home directory.
+func fileAction(name, kind, dir string) error {
+	if findAction(name) != nil {
+		return fmt.Errorf("There is already an action named '%s'.", name)
+	}
+	if strings.HasPrefix(dir, "~/") {
+		dir = filepath.Join(os.Getenv("HOME"), dir[2:])
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	desc := fmt.Sprintf("Move the current image to '%s'.", dir)
+	if kind == "copy" {
+		desc = fmt.Sprintf("Copy the current image to '%s'.", dir)
+	}
+	op := fileOp{kind, dir}
+	actions = append(actions, action{
+		name, desc, func(w *window) { w.chans.fileChan <- op },
+	})
+	return nil
+}
+
+// run is meant to be run as a goroutine and performs the operation on the
+// image at index (described by info and decoded). The result is sent on
+// doneChan. (Undoing is done by untrash instead.)
+func (op fileOp) run(index int, info imgInfo, decoded image.Image,
+	doneChan chan fileDone) {
+
+	done := fileDone{op: op, decoded: decoded}
+	switch op.kind {
+	case "trash":
+		trashName, infoName, err := trashFile(info.fName)
+		if err != nil {
+			done.err = fmt.Errorf("Could not move '%s' to the trash: %s",
+				info.fName, err)
+			break
+		}
+		done.trashed = &trashed{index, info, decoded, trashName, infoName}
+		lg("Moved '%s' to the trash.", info.fName)
+	case "move", "copy":
+		dest := filepath.Join(op.dir, filepath.Base(info.fName))
+		if _, err := os.Lstat(dest); err == nil {
+			done.err = fmt.Errorf("Could not %s '%s' to '%s': the file "+
+				"already exists.", op.kind, info.fName, op.dir)
+			break
+		}
+		var err error
+		if op.kind == "move" {
+			err = moveFile(info.fName, dest)
+		} else {
+			err = copyFile(info.fName, dest)
+		}
+		if err != nil {
+			done.err = fmt.Errorf("Could not %s '%s' to '%s': %s",
+				op.kind, info.fName, op.dir, err)
+			break
+		}
+		lg("Done: %s '%s' to '%s'.", op.kind, info.fName, op.dir)
+	}
+	doneChan <- done
+}
+
+// untrash is meant to be run as a goroutine and restores the file of the
+// trashed image t. The result is sent on doneChan.
+func untrash(t *trashed, doneChan chan fileDone) {
+	done := fileDone{op: fileOp{kind: "undo"}, decoded: t.decoded, trashed: t}
+	abs, err := filepath.Abs(t.info.fName)
+	if err == nil {
+		if _, err = os.Lstat(abs); err == nil {
+			err = fmt.Errorf("the file already exists")
+		} else {
+			err = moveFile(t.trashName, abs)
+		}
+	}
+	if err != nil {
+		done.err = fmt.Errorf("Could not restore '%s' from the trash: %s",
+			t.info.fName, err)
+	} else {
+		os.Remove(t.infoName)
+		lg("Restored '%s' from the trash.", t.info.fName)
+	}
+	doneChan <- done
+}
+
+// renameFile renames the file fName to name, which stays in the same
+// directory, and returns the new file name. An existing file is never
+// replaced.
+func renameFile(fName, name string) (string, error) {
+	if len(name) == 0 || name == "." || name == ".." ||
+		strings.Contains(name, "/") {
+
+		return "", fmt.Errorf("Could not rename '%s': '%s' is not a valid "+
+			"file name.", fName, name)
+	}
+	dest := filepath.Join(filepath.Dir(fName), name)
+	if dest == filepath.Clean(fName) {
+		return fName, nil
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("Could not rename '%s' to '%s': the file "+
+			"already exists.", fName, name)
+	}
+	if err := os.Rename(fName, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// trashDir returns the freedesktop.org trash directory in the user's home,
+// which is "$XDG_DATA_HOME/Trash".
+func trashDir() string {
+	data := os.Getenv("XDG_DATA_HOME")
+	if len(data) == 0 {
+		data = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return filepath.Join(data, "Trash")
+}
+
+// trashFile moves the file fName to the trash, following the freedesktop.org
+// trash specification: the file is moved to the "files" directory of the
+// trash, and a file describing where it came from (and when) is written to
+// the "info" directory. A number is added to the name in the trash if it's
+// already taken in either directory. The names of both files are returned.
+// Files on other file systems are copied to the trash in the user's home,
+// rather than to the trash at the top of their file system.
+func trashFile(fName string) (trashName, infoName string, err error) {
+	abs, err := filepath.Abs(fName)
+	if err != nil {
+		return "", "", err
+	}
+	files := filepath.Join(trashDir(), "files")
+	info := filepath.Join(trashDir(), "info")
+	for _, dir := range []string{files, info} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", "", err
+		}
+	}
+
+	base := filepath.Base(abs)
+	ext := filepath.Ext(base)
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), n,
+				ext)
+		}
+
+		// Creating the info file first reserves the name. But a file may
+		// have been left in "files" without its info file, and it must not
+		// be overwritten, so the name has to be free there too.
+		infoName = filepath.Join(info, name+".trashinfo")
+		f, err := os.OpenFile(infoName, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+			0600)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", "", err
+		}
+		trashName = filepath.Join(files, name)
+		if _, err := os.Lstat(trashName); !os.IsNotExist(err) {
+			f.Close()
+			os.Remove(infoName)
+			if err != nil {
+				return "", "", err
+			}
+			continue
+		}
+
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: abs}).EscapedPath(),
+			time.Now().Format("2006-01-02T15:04:05"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = moveFile(abs, trashName)
+		}
+		if err != nil {
+			os.Remove(infoName)
+			return "", "", err
+		}
+		return trashName, infoName, nil
+	}
+}
+
+// moveFile renames the file src to dest. If they're on different file
+// systems, the file is copied and then removed.
+func moveFile(src, dest string) error {
+	err := os.Rename(src, dest)
+	if lerr, ok := err.(*os.LinkError); !ok || lerr.Err != syscall.EXDEV {
+		return err
+	}
+	if err := copyFile(src, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies the contents and permissions of the file src to dest,
+// which must not exist.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+		fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
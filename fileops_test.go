@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrashFileNames(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	files := filepath.Join(trashDir(), "files")
+	info := filepath.Join(trashDir(), "info")
+	for _, d := range []string{files, info} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a.png is taken in "files" (without an info file) and a.2.png is
+	// taken in "info" (without a file), so a.png is trashed as a.3.png.
+	taken := map[string]string{
+		filepath.Join(files, "a.png"):            "left behind",
+		filepath.Join(info, "a.2.png.trashinfo"): "[Trash Info]\n",
+	}
+	for fName, data := range taken {
+		if err := os.WriteFile(fName, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		data, trashName string
+	}{
+		{"first", "a.3.png"},
+		{"second", "a.4.png"},
+	}
+	for _, test := range tests {
+		fName := filepath.Join(dir, "a.png")
+		if err := os.WriteFile(fName, []byte(test.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		trashName, infoName, err := trashFile(fName)
+		if err != nil {
+			t.Fatalf("trashFile(%s): %s", test.data, err)
+		}
+		if want := filepath.Join(files, test.trashName); trashName != want {
+			t.Errorf("trashFile(%s) = %s, want %s",
+				test.data, trashName, want)
+		}
+		want := filepath.Join(info, test.trashName+".trashinfo")
+		if infoName != want {
+			t.Errorf("trashFile(%s): info file is %s, want %s",
+				test.data, infoName, want)
+		}
+		if data, err := os.ReadFile(trashName); err != nil ||
+			string(data) != test.data {
+
+			t.Errorf("trashFile(%s): trashed file has '%s' (%v)",
+				test.data, data, err)
+		}
+		if _, err := os.Lstat(fName); !os.IsNotExist(err) {
+			t.Errorf("trashFile(%s): file is still there", test.data)
+		}
+	}
+
+	// Files that were already there are left alone.
+	for fName, data := range taken {
+		if got, err := os.ReadFile(fName); err != nil || string(got) != data {
+			t.Errorf("'%s' changed to '%s' (%v)", fName, got, err)
+		}
+	}
+}
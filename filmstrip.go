@@ -0,0 +1,97 @@
+package main
+
+import (
+	"image"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil/xgraphics"
+)
+
+// stripThumbSize is the maximum width and height of a thumbnail in the
+// filmstrip.
+const stripThumbSize = 64
+
+// stripPad is the amount of space (in pixels) around each thumbnail in the
+// filmstrip.
+const stripPad = 4
+
+// filmstrip keeps the state of the strip of thumbnails along the bottom of
+// the window. It is only ever touched by the canvas goroutine.
+type filmstrip struct {
+	// active is true when the filmstrip is shown.
+	active bool
+
+	// thumbs contains a small thumbnail for each image, or nil if it hasn't
+	// been generated yet.
+	thumbs []*xgraphics.Image
+}
+
+// height is the height of the filmstrip, which is 0 when it isn't shown.
+func (f *filmstrip) height() int {
+	if !f.active {
+		return 0
+	}
+	return f.cellSize()
+}
+
+// cellSize is the width and height of a single cell in the filmstrip.
+func (f *filmstrip) cellSize() int {
+	return stripThumbSize + 2*stripPad
+}
+
+// first returns the index of the left-most visible thumbnail, such that the
+// current image is in the middle of the strip whenever possible.
+func (f *filmstrip) first(win *window, current int) int {
+	n := max(1, win.Geom.Width()/f.cellSize())
+	return max(0, min(len(f.thumbs)-n, current-n/2))
+}
+
+// margin is the left offset of the filmstrip, which centers it horizontally
+// when there are fewer thumbnails than can fit.
+func (f *filmstrip) margin(win *window) int {
+	n := min(len(f.thumbs), max(1, win.Geom.Width()/f.cellSize()))
+	return max(0, (win.Geom.Width()-n*f.cellSize())/2)
+}
+
+// cellAt returns the index of the image whose thumbnail contains the point
+// pt (in window coordinates), or -1 if there is no such image.
+func (f *filmstrip) cellAt(win *window, current int, pt image.Point) int {
+	top := win.Geom.Height() - f.height()
+	x := pt.X - f.margin(win)
+	if !f.active || pt.Y < top || x < 0 {
+		return -1
+	}
+	i := f.first(win, current) + x/f.cellSize()
+	if i >= len(f.thumbs) {
+		return -1
+	}
+	return i
+}
+
+// draw clears the area of the window occupied by the filmstrip and paints
+// the thumbnails surrounding the current image. The current image is
+// outlined.
+func (f *filmstrip) draw(win *window, current int) {
+	if !f.active {
+		return
+	}
+
+	cs := f.cellSize()
+	top := win.Geom.Height() - cs
+	xproto.ClearArea(win.X.Conn(), false, win.Id, 0, int16(top),
+		uint16(win.Geom.Width()), uint16(cs))
+
+	first, x := f.first(win, current), f.margin(win)
+	for i := first; i < len(f.thumbs) && x < win.Geom.Width(); i++ {
+		if thumb := f.thumbs[i]; thumb != nil {
+			b := thumb.Bounds()
+			thumb.XExpPaint(win.Id,
+				x+(cs-b.Dx())/2, top+(cs-b.Dy())/2)
+		}
+		if i == current {
+			win.outline(image.Rect(x, top, x+cs, top+cs))
+		}
+		x += cs
+	}
+}
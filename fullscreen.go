@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil/ewmh"
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// fullState records whether the window is fullscreen. It is set by the X
+// event loop (when the window manager changes _NET_WM_STATE) and read by the
+// canvas goroutine (when it resizes the window), so it is protected by a
+// mutex.
+type fullState struct {
+	sync.Mutex
+	on bool
+}
+
+// isFullscreen returns true when the window covers its monitor.
+func (w *window) isFullscreen() bool {
+	w.full.Lock()
+	defer w.full.Unlock()
+	return w.full.on
+}
+
+// ewmhFullscreen returns true if there is a window manager running that
+// supports the _NET_WM_STATE_FULLSCREEN state.
+func (w *window) ewmhFullscreen() bool {
+	return w.ewmhSupported("_NET_WM_STATE_FULLSCREEN")
+}
+
+// ewmhSupported returns true if there is a window manager running that
+// supports the EWMH hint named atom.
+func (w *window) ewmhSupported(atom string) bool {
+	if _, err := ewmh.GetEwmhWM(w.X); err != nil {
+		return false
+	}
+	supported, err := ewmh.SupportedGet(w.X)
+	if err != nil {
+		return false
+	}
+	for _, name := range supported {
+		if name == atom {
+			return true
+		}
+	}
+	return false
+}
+
+// toggleFullscreen asks the window manager to toggle fullscreen mode. If
+// the window manager doesn't support EWMH, the window fakes it by becoming
+// an override-redirect window the size of the monitor it is on.
+func (w *window) toggleFullscreen() {
+	if !w.ewmhFullscreen() {
+		w.fakeFullscreen(!w.isFullscreen())
+		return
+	}
+
+	// Make sure that fullscreen only covers the current monitor.
+	if !w.isFullscreen() && w.ewmhSupported("_NET_WM_FULLSCREEN_MONITORS") {
+		i, _ := w.monitor()
+		edges := &ewmh.WmFullscreenMonitors{
+			Top: uint(i), Bottom: uint(i), Left: uint(i), Right: uint(i),
+		}
+		err := ewmh.WmFullscreenMonitorsReq(w.X, w.Id, edges)
+		if err != nil {
+			lg("Could not set _NET_WM_FULLSCREEN_MONITORS: %s", err)
+		}
+	}
+
+	err := ewmh.WmStateReq(w.X, w.Id, ewmh.StateToggle,
+		"_NET_WM_STATE_FULLSCREEN")
+	if err != nil {
+		errLg.Printf("Could not toggle fullscreen: %s", err)
+	}
+	// The window manager will change _NET_WM_STATE, and stateChanged will
+	// be called when it does.
+}
+
+// stateChanged is called whenever _NET_WM_STATE changes, so that the window
+// can keep track of whether it is fullscreen or not.
+func (w *window) stateChanged() {
+	states, err := ewmh.WmStateGet(w.X, w.Id)
+	if err != nil {
+		lg("Could not get _NET_WM_STATE: %s", err)
+		return
+	}
+	full := false
+	for _, state := range states {
+		if state == "_NET_WM_STATE_FULLSCREEN" {
+			full = true
+		}
+	}
+	if full != w.isFullscreen() {
+		w.fullscreenSet(full)
+	}
+}
+
+// fullscreenSet records whether the window is fullscreen and updates the
+// window background to match. The canvas is asked to repaint everything (if
+// it has been created yet).
+func (w *window) fullscreenSet(full bool) {
+	w.full.Lock()
+	w.full.on = full
+	w.full.Unlock()
+
+	if full {
+		w.Change(xproto.CwBackPixel, flagFullscreenBg.pixel())
+	} else {
+		w.Change(xproto.CwBackPixel, flagBackground.pixel())
+	}
+	if w.chans.geomChan != nil {
+		w.chans.geomChan <- struct{}{}
+	}
+}
+
+// fakeFullscreen makes the window cover its monitor without any help
+// from the window manager. This is done by making the window an
+// override-redirect window (so that the window manager leaves it alone), and
+// grabbing the keyboard (since the window manager won't give it focus).
+// The window has to be unmapped and mapped again for override-redirect to
+// take effect.
+func (w *window) fakeFullscreen(full bool) {
+	w.Unmap()
+	if full {
+		w.restoreGeom = xrect.New(w.Geom.Pieces())
+		if geom, err := w.DecorGeometry(); err == nil {
+			w.restoreGeom.XSet(geom.X())
+			w.restoreGeom.YSet(geom.Y())
+		}
+
+		_, head := w.monitor()
+		w.Change(xproto.CwOverrideRedirect, 1)
+		w.MoveResize(head.Pieces())
+		w.Map()
+		w.Stack(xproto.StackModeAbove)
+		w.X.Sync()
+
+		reply, err := xproto.GrabKeyboard(w.X.Conn(), true, w.Id,
+			xproto.TimeCurrentTime, xproto.GrabModeAsync,
+			xproto.GrabModeAsync).Reply()
+		if err != nil || reply.Status != xproto.GrabStatusSuccess {
+			errLg.Println("Could not grab the keyboard. Keybindings may " +
+				"not work in fullscreen mode.")
+		}
+	} else {
+		xproto.UngrabKeyboard(w.X.Conn(), xproto.TimeCurrentTime)
+		w.Change(xproto.CwOverrideRedirect, 0)
+		w.Map()
+		if w.restoreGeom != nil {
+			w.WMMoveResize(w.restoreGeom.Pieces())
+		}
+	}
+	w.fullscreenSet(full)
+}
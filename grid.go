@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/BurntSushi/xgbutil/xgraphics"
+)
+
+// gridPad is the amount of space (in pixels) around each thumbnail in the
+// grid. The selected thumbnail is outlined inside of this space.
+const gridPad = 8
+
+// grid keeps the state of the thumbnail browsing mode. It is only ever
+// touched by the canvas goroutine.
+type grid struct {
+	// active is true when the grid is shown instead of a single image.
+	active bool
+
+	// selected is the index of the image that is currently selected.
+	selected int
+
+	// top is the first row of thumbnails that is visible. It is updated
+	// whenever the grid is drawn so that the selection is always visible.
+	top int
+
+	// thumbs contains a thumbnail for each image, or nil if it hasn't
+	// been generated yet.
+	thumbs []*xgraphics.Image
+}
+
+// cellSize is the width and height of a single cell in the grid.
+func (g *grid) cellSize() int {
+	return thumbSize + 2*gridPad
+}
+
+// dims returns the number of columns and the number of (fully or partially)
+// visible rows that fit in the window.
+func (g *grid) dims(win *window) (cols, rows int) {
+	cs := g.cellSize()
+	cols = max(1, win.Geom.Width()/cs)
+	rows = max(1, (win.Geom.Height()+cs-1)/cs)
+	return
+}
+
+// margin is the left offset of the grid, which centers it horizontally.
+func (g *grid) margin(win *window) int {
+	cols, _ := g.dims(win)
+	return max(0, (win.Geom.Width()-cols*g.cellSize())/2)
+}
+
+// cellRect returns the rectangle in window coordinates occupied by the cell
+// of the image at index i. It takes the current scroll position into account.
+func (g *grid) cellRect(win *window, i int) image.Rectangle {
+	cols, _ := g.dims(win)
+	cs := g.cellSize()
+	x := g.margin(win) + (i%cols)*cs
+	y := (i/cols - g.top) * cs
+	return image.Rect(x, y, x+cs, y+cs)
+}
+
+// cellAt returns the index of the image whose cell contains the point pt (in
+// window coordinates), or -1 if there is no such image.
+func (g *grid) cellAt(win *window, pt image.Point) int {
+	cols, _ := g.dims(win)
+	cs := g.cellSize()
+	x := pt.X - g.margin(win)
+	if x < 0 || x >= cols*cs || pt.Y < 0 {
+		return -1
+	}
+	i := (g.top+pt.Y/cs)*cols + x/cs
+	if i >= len(g.thumbs) {
+		return -1
+	}
+	return i
+}
+
+// move changes the selection by dx columns and dy rows. Moving off either
+// end of a row wraps to the adjacent row, but the selection never leaves the
+// list of images.
+func (g *grid) move(win *window, dx, dy int) {
+	cols, _ := g.dims(win)
+	sel := g.selected + dx + dy*cols
+	if sel < 0 || sel >= len(g.thumbs) {
+		return
+	}
+	g.selected = sel
+}
+
+// scroll updates the first visible row so that the selection can be seen.
+func (g *grid) scroll(win *window) {
+	cols, rows := g.dims(win)
+
+	// Only rows that fit completely count when scrolling down.
+	full := max(1, win.Geom.Height()/g.cellSize())
+	if rows > full {
+		rows = full
+	}
+
+	row := g.selected / cols
+	if row < g.top {
+		g.top = row
+	} else if row >= g.top+rows {
+		g.top = row - rows + 1
+	}
+}
+
+// draw clears the window and paints every visible thumbnail along with the
+// selection outline and the markers of marked images.
+func (g *grid) draw(win *window, names []string, marked []bool) {
+	g.scroll(win)
+	win.ClearAll()
+
+	cols, rows := g.dims(win)
+	first := g.top * cols
+	last := min(len(g.thumbs), first+rows*cols)
+	for i := first; i < last; i++ {
+		g.drawCell(win, i, marked[i])
+	}
+
+	name := fmt.Sprintf("%s [%d/%d]",
+		names[g.selected], g.selected+1, len(g.thumbs))
+	if marked[g.selected] {
+		name += " (marked)"
+	}
+	win.nameSet(name)
+	win.drawPrompt()
+}
+
+// drawCell paints a single thumbnail centered in its cell. If the thumbnail
+// at index i is selected, it is outlined, and if its image is marked, a
+// marker is drawn in the top-right corner of the cell.
+func (g *grid) drawCell(win *window, i int, marked bool) {
+	r := g.cellRect(win, i)
+	if r.Max.Y <= 0 || r.Min.Y >= win.Geom.Height() {
+		return
+	}
+	if thumb := g.thumbs[i]; thumb != nil {
+		b := thumb.Bounds()
+		thumb.XExpPaint(win.Id,
+			r.Min.X+(r.Dx()-b.Dx())/2, r.Min.Y+(r.Dy()-b.Dy())/2)
+	}
+	if i == g.selected {
+		win.outline(r.Inset(gridPad / 2))
+	}
+	if marked {
+		corner := image.Pt(r.Max.X-gridPad, r.Min.Y+gridPad)
+		win.fill(image.Rect(corner.X-markSize, corner.Y,
+			corner.X, corner.Y+markSize), markColor)
+	}
+}
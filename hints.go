@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/BurntSushi/xgbutil/ewmh"
+	"github.com/BurntSushi/xgbutil/icccm"
+	"github.com/BurntSushi/xgbutil/xgraphics"
+)
+
+// classSet sets WM_CLASS, so that window manager rules can match imgv
+// windows. The class can be changed with --class.
+func (w *window) classSet() {
+	err := icccm.WmClassSet(w.X, w.Id, &icccm.WmClass{
+		Instance: "imgv",
+		Class:    flagClass,
+	})
+	if err != nil { // not a fatal error
+		lg("Could not set WM_CLASS: %s", err)
+	}
+}
+
+// hintsSet sets WM_NORMAL_HINTS for an image that is width x height pixels.
+// The window manager is asked to not make the window smaller than the
+// image's thumbnail, and if aspect is true, to keep the window at the aspect
+// ratio of the image. (The thumbnail grid and the comparison mode don't show
+// a single image, so they don't keep an aspect ratio.) The filmstrip is
+// given as the base size, so that it doesn't count towards the aspect ratio.
+func (w *window) hintsSet(width, height int, aspect bool) {
+	minw, minh := width, height
+	if width > thumbSize || height > thumbSize {
+		if width >= height {
+			minw, minh = thumbSize, max(1, height*thumbSize/width)
+		} else {
+			minw, minh = max(1, width*thumbSize/height), thumbSize
+		}
+	}
+	var flags uint = icccm.SizeHintPMinSize | icccm.SizeHintPBaseSize
+	if aspect {
+		flags |= icccm.SizeHintPAspect
+	}
+	err := icccm.WmNormalHintsSet(w.X, w.Id, &icccm.NormalHints{
+		Flags:        flags,
+		MinWidth:     uint(minw),
+		MinHeight:    uint(minh + w.stripHeight),
+		MinAspectNum: uint(width),
+		MinAspectDen: uint(height),
+		MaxAspectNum: uint(width),
+		MaxAspectDen: uint(height),
+		BaseHeight:   uint(w.stripHeight),
+	})
+	if err != nil { // not a fatal error
+		lg("Could not set WM_NORMAL_HINTS: %s", err)
+	}
+}
+
+// iconSet sets _NET_WM_ICON to the given thumbnails, so that the taskbar
+// shows the current image. Thumbnails that haven't been generated yet (nil)
+// are skipped.
+func (w *window) iconSet(thumbs ...*xgraphics.Image) {
+	icons := make([]ewmh.WmIcon, 0, len(thumbs))
+	for _, thumb := range thumbs {
+		if thumb == nil {
+			continue
+		}
+		r := thumb.Bounds()
+		data := make([]uint, 0, r.Dx()*r.Dy())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				// xgraphics stores pixels as BGRA, and _NET_WM_ICON wants
+				// ARGB.
+				p := thumb.Pix[thumb.PixOffset(x, y):]
+				data = append(data, uint(p[3])<<24|uint(p[2])<<16|
+					uint(p[1])<<8|uint(p[0]))
+			}
+		}
+		icons = append(icons, ewmh.WmIcon{
+			Width:  uint(r.Dx()),
+			Height: uint(r.Dy()),
+			Data:   data,
+		})
+	}
+	if len(icons) == 0 {
+		return
+	}
+	if err := ewmh.WmIconSet(w.X, w.Id, icons); err != nil {
+		lg("Could not set _NET_WM_ICON: %s", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"image"
+	"time"
+)
+
+// histHeight is the height (in pixels) of the histogram curves.
+const histHeight = 100
+
+// histKey identifies what a histogram was computed from: a region of a
+// decoded image.
+type histKey struct {
+	decoded image.Image
+	region  image.Rectangle
+}
+
+// histogram contains the number of pixels with each value of the red,
+// green, blue and luma channels.
+type histogram struct {
+	key              histKey
+	red, green, blue [256]int
+	luma             [256]int
+}
+
+// newHistogram is meant to be run as a goroutine and computes the histogram
+// described by key. The histogram is sent on histChan when it's done.
+// Fully transparent pixels are skipped, since their color can't be seen.
+func newHistogram(key histKey, histChan chan *histogram) {
+	start := time.Now()
+	img := pixels(key.decoded)
+	hist := &histogram{key: key}
+	r := key.region
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, ca := img.At(x, y).RGBA()
+			if ca == 0 {
+				continue
+			}
+			cr, cg, cb = cr>>8, cg>>8, cb>>8
+			hist.red[cr]++
+			hist.green[cg]++
+			hist.blue[cb]++
+			hist.luma[(299*cr+587*cg+114*cb)/1000]++
+		}
+	}
+	lg("Computed histogram of %s (%s).", r, time.Since(start))
+
+	histChan <- hist
+}
+
+// histPanel keeps the state of the histogram panel, which is drawn in the
+// top-right corner of the viewport. It is only ever touched by the canvas
+// goroutine.
+type histPanel struct {
+	// active is true when the histogram panel is shown.
+	active bool
+
+	// visible is true when the histogram should only describe the part of
+	// the image that is visible, rather than the whole image.
+	visible bool
+
+	// hist is the last histogram computed, which may not be for the
+	// current image.
+	hist *histogram
+
+	// pending is the histogram currently being computed, if any. Only one
+	// histogram is computed at a time, since panning in the visible region
+	// mode asks for a new one at every step. (The one that is needed by
+	// then is computed next.)
+	pending *histKey
+}
+
+// key returns the key of the histogram that should be shown for the decoded
+// image, which is shown as img with the given origin. (img may be a scaled
+// down copy. See fitImage.)
+func (h *histPanel) key(win *window, decoded image.Image, img *vimage,
+	origin image.Point) histKey {
+
+	region := decoded.Bounds()
+	if h.visible {
+		vw, vh := win.viewport()
+		visible := image.Rect(origin.X, origin.Y, origin.X+vw, origin.Y+vh)
+		if img != nil {
+			visible = image.Rectangle{
+				img.unscale(visible.Min), img.unscale(visible.Max),
+			}
+		}
+		region = region.Intersect(visible)
+	}
+	return histKey{decoded, region}
+}
+
+// draw paints the histogram panel if it's active. If the histogram hasn't
+// been computed yet, a new goroutine is started to compute it (unless one is
+// already running), and the canvas should call draw again when it's done.
+func (h *histPanel) draw(win *window, key histKey, histChan chan *histogram) {
+
+	if !h.active {
+		return
+	}
+
+	title := "Histogram"
+	if h.visible {
+		title = "Histogram (visible region)"
+	}
+	if h.hist == nil || h.hist.key != key {
+		if h.pending == nil {
+			h.pending = &key
+			go newHistogram(key, histChan)
+		}
+		title = "Histogram (computing...)"
+	}
+
+	vw, _ := win.viewport()
+	width := 256 + 2*textPad
+	tw, th := win.textSize([]string{title})
+	width = max(width, tw)
+	x := vw - width
+	win.text(x, 0, []string{title})
+
+	box := image.Rect(x, th, x+width, th+histHeight+2*textPad)
+	win.fill(box, 0x000000)
+	if h.hist == nil || h.hist.key != key {
+		return
+	}
+
+	// Scale all of the curves by the same amount, so they can be compared.
+	most := 1
+	for i := 0; i < 256; i++ {
+		most = max(most, max(h.hist.luma[i], max(h.hist.red[i],
+			max(h.hist.green[i], h.hist.blue[i]))))
+	}
+	bottom := box.Max.Y - textPad
+	curve := func(counts *[256]int, clr uint32) {
+		points := make([]image.Point, 256)
+		for i := range points {
+			points[i] = image.Point{
+				box.Min.X + textPad + i,
+				bottom - counts[i]*histHeight/most,
+			}
+		}
+		win.polyline(points, clr)
+	}
+	curve(&h.hist.red, 0xff4040)
+	curve(&h.hist.green, 0x40ff40)
+	curve(&h.hist.blue, 0x4040ff)
+	curve(&h.hist.luma, 0xffffff)
+}
+
+// loaded is called when a histogram has been computed. It returns true if
+// the panel needs to be drawn again, which also starts computing the
+// histogram that is needed now, if this one is already out of date.
+func (h *histPanel) loaded(hist *histogram) bool {
+	h.hist, h.pending = hist, nil
+	return h.active
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"image"
+	"image/color"
+	"math"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/xgbutil"
@@ -13,45 +17,218 @@ import (
 type vimage struct {
 	*xgraphics.Image
 	name string
+
+	// scale is how much the image was scaled down to fit in the work area,
+	// or 0 if it is the image at its full size. (See fitImage.)
+	scale float64
+}
+
+// unscale maps the point pt in img back to the point in the full size image.
+func (img *vimage) unscale(pt image.Point) image.Point {
+	if img.scale == 0 {
+		return pt
+	}
+	return image.Pt(int(float64(pt.X)/img.scale),
+		int(float64(pt.Y)/img.scale))
+}
+
+// zoom returns the scale of img as a percentage.
+func (img *vimage) zoom() int {
+	if img.scale == 0 {
+		return 100
+	}
+	return int(img.scale*100 + 0.5)
+}
+
+// fitted is the kind of value sent from fitImage when an image has been
+// scaled down. decoded is the decoded image that was scaled, and box and
+// render are what it was scaled and converted for.
+type fitted struct {
+	img     *vimage
+	decoded image.Image
+	box     image.Point
+	render  render
+}
+
+// fitSize returns the size that an image of the given size is shown at when
+// it has to fit in box, and the scale that it's shown at. An image that
+// already fits isn't scaled, in which case the scale is 0.
+func fitSize(size, box image.Point) (image.Point, float64) {
+	if size.X <= box.X && size.Y <= box.Y {
+		return size, 0
+	}
+	scale := math.Min(float64(box.X)/float64(size.X),
+		float64(box.Y)/float64(size.Y))
+	return image.Pt(max(1, int(float64(size.X)*scale)),
+		max(1, int(float64(size.Y)*scale))), scale
+}
+
+// fitImage is meant to be run as a goroutine and scales the converted image
+// img (decoded as decoded, and rendered as rend) down to fit in box. The
+// scaled image is drawn to an X pixmap and sent on fitChan.
+// This is how the window shows images that are bigger than the work area
+// when it is resized to each image. The full size image is kept, since it's
+// still used by the comparison mode.
+func fitImage(X *xgbutil.XUtil, img *vimage, decoded image.Image,
+	box image.Point, rend render, fitChan chan fitted) {
+
+	start := time.Now()
+	size, scale := fitSize(img.Bounds().Size(), box)
+	reg := xgraphics.NewConvert(X, scaleTo(img, size.X, size.Y))
+	if err := reg.CreatePixmap(); err != nil {
+		errLg.Fatal(err)
+	}
+	reg.XDraw()
+	lg("Scaled '%s' down to %dx%d (%s).", img.name, size.X, size.Y,
+		time.Since(start))
+
+	fitChan <- fitted{
+		img:     &vimage{Image: reg, name: img.name, scale: scale},
+		decoded: decoded,
+		box:     box,
+		render:  rend,
+	}
+}
+
+// lazyImage is an image file that isn't decoded until its pixels are needed.
+// Its bounds and color model are read from the header of the file, which is
+// a lot cheaper than decoding all of it. A lazyImage stands in for the
+// decoded image everywhere, including as the identity of the image in the
+// canvas' list.
+type lazyImage struct {
+	fName  string
+	config image.Config
+
+	// img is the decoded image, once it has been kept. It and fName are
+	// protected by mu, which is also held while decoding so that the file
+	// isn't decoded by two goroutines at once.
+	mu  sync.Mutex
+	img image.Image
+}
+
+func (l *lazyImage) ColorModel() color.Model { return l.config.ColorModel }
+
+func (l *lazyImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, l.config.Width, l.config.Height)
+}
+
+func (l *lazyImage) At(x, y int) color.Color {
+	return l.decode(true).At(x, y)
+}
+
+// decode returns the decoded image, decoding the file if it hasn't been
+// kept yet. If keep is true, the decoded image is kept for next time.
+// (Thumbnails are generated without keeping it, so that images that are
+// never shown don't stay in memory.)
+// If the file can't be decoded anymore, a transparent image is returned
+// instead.
+func (l *lazyImage) decode(keep bool) image.Image {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.img != nil {
+		return l.img
+	}
+
+	img, err := func() (image.Image, error) {
+		file, err := os.Open(l.fName)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		start := time.Now()
+		img, kind, err := image.Decode(file)
+		if err != nil {
+			return nil, err
+		}
+		lg("Decoded '%s' into image type '%s' (%s).",
+			l.fName, kind, time.Since(start))
+		return img, nil
+	}()
+	if err != nil {
+		errLg.Printf("Could not decode '%s': %s", l.fName, err)
+		img = image.NewNRGBA(l.Bounds())
+	}
+	if keep {
+		l.img = img
+	}
+	return img
+}
+
+// rename changes the file that the image is decoded from, after the file
+// has been renamed.
+func (l *lazyImage) rename(fName string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fName = fName
+}
+
+// pixels returns the decoded image of img, which is decoded (and kept) if
+// it's a lazyImage. Code that reads every pixel should use this, since
+// going through lazyImage.At is slow and hides the image's concrete type.
+func pixels(img image.Image) image.Image {
+	if l, ok := img.(*lazyImage); ok {
+		return l.decode(true)
+	}
+	return img
+}
+
+// backdrops is the list of backdrops that transparent images can be blended
+// into, in the order that the cycle-backdrop action goes through them.
+var backdrops = []string{"checker", "solid", "black"}
+
+// validBackdrop returns true if backdrop is in the backdrops list.
+func validBackdrop(backdrop string) bool {
+	for _, name := range backdrops {
+		if name == backdrop {
+			return true
+		}
+	}
+	return false
 }
 
 // newImage is meant to be run as a goroutine and loads a decoded image into
 // an xgraphics.Image value and draws it to an X pixmap.
 // The loading doesn't start until this image's corresponding imgLoadChan
-// has been pinged.
-// This implies that all images are decoded on start-up and are converted
-// and drawn to an X pixmap on-demand. I am still deliberating on whether this
-// is a smart decision.
+// has been sent how to render the image. If imgLoadChan is closed instead
+// (because the image was reloaded), nothing is loaded.
+// This implies that images are decoded (if they haven't been already),
+// converted and drawn to an X pixmap on-demand.
 // Note that this process, particularly image conversion, can be quite
 // costly for large images.
 func newImage(X *xgbutil.XUtil, name string, img image.Image, index int,
-	imgLoadChan chan struct{}, imgChan chan imageLoaded) {
+	imgLoadChan chan render, imgChan chan imageLoaded) {
 
 	// Don't start loading until we're told to do so.
-	<-imgLoadChan
+	rend, ok := <-imgLoadChan
+	if !ok {
+		return
+	}
 
 	// We send this when we're done processing this image, whether its
 	// an error or not.
-	loaded := imageLoaded{index: index}
+	loaded := imageLoaded{index: index, decoded: img, render: rend}
+	img = pixels(img)
 
 	start := time.Now()
 	reg := xgraphics.NewConvert(X, img)
 	lg("Converted '%s' to an xgraphics.Image type (%s).",
 		name, time.Since(start))
 
-	// Only blend a checkered background if the image *may* have an alpha 
-	// channel. If we want to be a bit more efficient, we could type switch
-	// on all image types use Opaque, but this may add undesirable overhead.
-	// (Where the overhead is scanning the image for opaqueness.)
-	switch img.(type) {
-	case *image.Gray:
-	case *image.Gray16:
-	case *image.YCbCr:
-	default:
-		start = time.Now()
-		blendCheckered(reg)
-		lg("Blended '%s' into a checkered background (%s).",
-			name, time.Since(start))
+	// Only blend the backdrop if the image has pixels that aren't opaque.
+	// Scanning for them is cheaper than blending, and the image types that
+	// can't have an alpha channel don't need to be scanned at all.
+	// Alpha modes other than "normal" always show the alpha channel, even
+	// if the image is opaque.
+	start = time.Now()
+	if rend.alpha != "normal" {
+		showAlpha(reg, img, rend)
+		lg("Rendered the %s alpha mode of '%s' (%s).",
+			rend.alpha, name, time.Since(start))
+	} else if hasAlpha(img) {
+		blendBackdrop(reg, rend.backdrop)
+		lg("Blended '%s' into a %s background (%s).",
+			name, rend.backdrop, time.Since(start))
 	}
 
 	if err := reg.CreatePixmap(); err != nil {
@@ -75,31 +252,39 @@ func newImage(X *xgbutil.XUtil, name string, img image.Image, index int,
 	imgChan <- loaded
 }
 
+// blendBackdrop blends dest into the backdrop with the given name. (See the
+// backdrops list.) The backdrop's colors come from the flags.
+func blendBackdrop(dest *xgraphics.Image, backdrop string) {
+	switch backdrop {
+	case "solid":
+		blendSolid(dest, flagBackdropColor.bgra())
+	case "black":
+		blendSolid(dest, xgraphics.BGRA{A: 0xff})
+	default:
+		blendCheckered(dest)
+	}
+}
+
 // blendCheckered is basically a copy of xgraphics.Blend with no interfaces.
-// (It's faster.) Also, it is hardcoded to blend into a checkered background.
+// (It's faster.) Also, it is hardcoded to blend into a checkered background,
+// whose squares are --checker-size pixels wide and alternate between the
+// --checker-light and --checker-dark colors.
 func blendCheckered(dest *xgraphics.Image) {
 	dsrc := dest.Bounds()
 	dmnx, dmxx, dmny, dmxy := dsrc.Min.X, dsrc.Max.X, dsrc.Min.Y, dsrc.Max.Y
 
-	clr1 := xgraphics.BGRA{B: 0xff, G: 0xff, R: 0xff, A: 0xff}
-	clr2 := xgraphics.BGRA{B: 0xde, G: 0xdc, R: 0xdf, A: 0xff}
+	clr1 := flagCheckerLight.bgra()
+	clr2 := flagCheckerDark.bgra()
+	size := max(1, flagCheckerSize)
 
 	var dx, dy int
 	var bgra, clr xgraphics.BGRA
 	for dx = dmnx; dx < dmxx; dx++ {
 		for dy = dmny; dy < dmxy; dy++ {
-			if dx%30 >= 15 {
-				if dy%30 >= 15 {
-					clr = clr1
-				} else {
-					clr = clr2
-				}
+			if ((dx-dmnx)/size+(dy-dmny)/size)%2 == 0 {
+				clr = clr1
 			} else {
-				if dy%30 >= 15 {
-					clr = clr2
-				} else {
-					clr = clr1
-				}
+				clr = clr2
 			}
 
 			bgra = dest.At(dx, dy).(xgraphics.BGRA)
@@ -107,3 +292,19 @@ func blendCheckered(dest *xgraphics.Image) {
 		}
 	}
 }
+
+// blendSolid is just like blendCheckered, except that it blends into a single
+// color.
+func blendSolid(dest *xgraphics.Image, clr xgraphics.BGRA) {
+	dsrc := dest.Bounds()
+	dmnx, dmxx, dmny, dmxy := dsrc.Min.X, dsrc.Max.X, dsrc.Min.Y, dsrc.Max.Y
+
+	var dx, dy int
+	var bgra xgraphics.BGRA
+	for dx = dmnx; dx < dmxx; dx++ {
+		for dy = dmny; dy < dmxy; dy++ {
+			bgra = dest.At(dx, dy).(xgraphics.BGRA)
+			dest.SetBGRA(dx, dy, xgraphics.BlendBGRA(clr, bgra))
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+// imgInfo describes an image file and the image decoded from it. It is
+// filled in when the image is decoded and is shown in the information
+// overlay.
+type imgInfo struct {
+	// fName is the file name of the image, as given on the command line.
+	fName string
+
+	// kind is the image format returned by image.Decode. i.e., "png".
+	kind string
+
+	// model describes the color model of the decoded image.
+	model string
+
+	// width and height are the dimensions of the decoded image.
+	width, height int
+
+	// size is the size of the image file in bytes.
+	size int64
+
+	// exif contains a few EXIF fields if the image has them.
+	exif exifInfo
+}
+
+// newInfo builds the information of an image file that was just opened.
+// Failures are not fatal; the information is just incomplete.
+func newInfo(fName, kind string, img image.Image) imgInfo {
+	info := imgInfo{
+		fName:  fName,
+		kind:   kind,
+		model:  colorModelName(img),
+		width:  img.Bounds().Dx(),
+		height: img.Bounds().Dy(),
+	}
+	if fi, err := os.Stat(fName); err != nil {
+		lg("Could not stat '%s': %s", fName, err)
+	} else {
+		info.size = fi.Size()
+	}
+	if kind == "jpeg" {
+		exif, err := readExif(fName)
+		if err != nil {
+			lg("Could not read EXIF data from '%s': %s", fName, err)
+		}
+		info.exif = exif
+	}
+	return info
+}
+
+// colorModelName returns a short description of the color model of img.
+// The description of an image that hasn't been decoded yet is shorter,
+// since only its color model is known.
+func colorModelName(img image.Image) string {
+	switch img := img.(type) {
+	case *lazyImage:
+		switch m := img.ColorModel(); m {
+		case color.RGBAModel:
+			return "RGBA"
+		case color.RGBA64Model:
+			return "RGBA (16 bit)"
+		case color.NRGBAModel:
+			return "NRGBA"
+		case color.NRGBA64Model:
+			return "NRGBA (16 bit)"
+		case color.GrayModel:
+			return "Gray"
+		case color.Gray16Model:
+			return "Gray (16 bit)"
+		case color.CMYKModel:
+			return "CMYK"
+		case color.YCbCrModel:
+			return "YCbCr"
+		default:
+			if p, ok := m.(color.Palette); ok {
+				return fmt.Sprintf("Paletted (%d colors)", len(p))
+			}
+			return fmt.Sprintf("%T", m)
+		}
+	case *image.RGBA:
+		return "RGBA"
+	case *image.RGBA64:
+		return "RGBA (16 bit)"
+	case *image.NRGBA:
+		return "NRGBA"
+	case *image.NRGBA64:
+		return "NRGBA (16 bit)"
+	case *image.Gray:
+		return "Gray"
+	case *image.Gray16:
+		return "Gray (16 bit)"
+	case *image.CMYK:
+		return "CMYK"
+	case *image.Paletted:
+		return fmt.Sprintf("Paletted (%d colors)", len(img.Palette))
+	case *image.YCbCr:
+		ratios := map[image.YCbCrSubsampleRatio]string{
+			image.YCbCrSubsampleRatio444: "4:4:4",
+			image.YCbCrSubsampleRatio422: "4:2:2",
+			image.YCbCrSubsampleRatio420: "4:2:0",
+			image.YCbCrSubsampleRatio440: "4:4:0",
+			image.YCbCrSubsampleRatio411: "4:1:1",
+			image.YCbCrSubsampleRatio410: "4:1:0",
+		}
+		return fmt.Sprintf("YCbCr %s", ratios[img.SubsampleRatio])
+	}
+	return fmt.Sprintf("%T", img)
+}
+
+// humanSize formats a number of bytes for humans. i.e., "1.5 MB".
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
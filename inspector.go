@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// inspector keeps the state of the pixel inspector, which shows the
+// coordinates and color of the pixel under the pointer. It is only ever
+// touched by the canvas goroutine.
+type inspector struct {
+	// active is true when the pixel inspector is shown.
+	active bool
+
+	// pointer is the last known position of the pointer in window
+	// coordinates.
+	pointer image.Point
+
+	// hex is the color of the last inspected pixel in #rrggbbaa format.
+	// It is empty if the pointer isn't over the image.
+	hex string
+}
+
+// pixel maps the position of the pointer back to a pixel in the decoded
+// image. The reverse of this mapping is done by show: the image is painted
+// starting at origin, and is centered in the viewport with vpCenter when it
+// is smaller than the viewport. If the image was scaled down to fit in the
+// work area, the scale is undone too. false is returned if the pointer isn't
+// over the image.
+func (ins *inspector) pixel(win *window, img *vimage,
+	origin image.Point) (image.Point, bool) {
+
+	vw, vh := win.viewport()
+	if !ins.pointer.In(image.Rect(0, 0, vw, vh)) {
+		return image.Point{}, false
+	}
+	pt := ins.pointer.Sub(vpCenter(img.Image, vw, vh)).Add(origin)
+	return img.unscale(pt), pt.In(img.Bounds())
+}
+
+// draw inspects the pixel under the pointer in the decoded image (not the
+// converted image, which has been blended into a checkered background) and
+// shows its coordinates and color in the bottom-left corner of the viewport.
+func (ins *inspector) draw(win *window, decoded image.Image, img *vimage,
+	origin image.Point) {
+
+	ins.hex = ""
+	if !ins.active || img == nil {
+		return
+	}
+
+	lines := []string{"Pixel: -"}
+	if pt, ok := ins.pixel(win, img, origin); ok {
+		c := color.NRGBAModel.Convert(decoded.At(pt.X, pt.Y)).(color.NRGBA)
+		ins.hex = fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+		lines = []string{
+			fmt.Sprintf("Pixel: %d, %d", pt.X, pt.Y),
+			fmt.Sprintf("RGBA: %d, %d, %d, %d", c.R, c.G, c.B, c.A),
+			fmt.Sprintf("Hex: %s", ins.hex),
+		}
+	}
+
+	_, vh := win.viewport()
+	_, height := win.textSize(lines)
+	win.text(0, vh-height, lines)
+}
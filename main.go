@@ -12,7 +12,6 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
-	"time"
 
 	"github.com/BurntSushi/xgbutil"
 	"github.com/BurntSushi/xgbutil/xevent"
@@ -30,6 +29,13 @@ var (
 	// that it displays.
 	flagAutoResize bool
 
+	// If set, the image window will resize to every image that it displays.
+	flagResizeEach bool
+
+	// What stays in place when the window is resized to an image: either
+	// "top-left" or "center".
+	flagResizeAnchor string
+
 	// The amount to increment panning when using h,j,k,l
 	flagStepIncrement int
 
@@ -39,45 +45,287 @@ var (
 	// When set, imgv will print all keybindings and exit.
 	flagKeybindings bool
 
-	// A list of keybindings. Each value corresponds to a triple of the key
-	// sequence to bind to, the action to run when that key sequence is
-	// pressed and a quick description of what the keybinding does.
-	keybinds = []keyb{
+	// The configuration file to read. It's also used to point out where
+	// keybindings came from when they're invalid.
+	flagConfig string
+
+	// When set, the configuration file won't be read.
+	flagNoConfig bool
+
+	// When set, the window starts in fullscreen mode.
+	flagFullscreen bool
+
+	// The background color of the window.
+	flagBackground = colorFlag(0xffffff)
+
+	// The backdrop that transparent images are blended into. (See the
+	// backdrops list.)
+	flagBackdrop string
+
+	// The color of the solid backdrop.
+	flagBackdropColor = colorFlag(0x808080)
+
+	// The colors of the squares in the checkered backdrop.
+	flagCheckerLight = colorFlag(0xffffff)
+	flagCheckerDark  = colorFlag(0xdfdcde)
+
+	// The size (in pixels) of the squares in the checkered backdrop.
+	flagCheckerSize int
+
+	// The background color of the window in fullscreen mode.
+	flagFullscreenBg = colorFlag(0x000000)
+
+	// The class in WM_CLASS, which window manager rules can match.
+	flagClass string
+
+	// The time (in milliseconds) between switching images when flickering
+	// between two images automatically.
+	flagFlickerInterval int
+
+	// The amount that differences between pixels are multiplied by in the
+	// difference heatmap.
+	flagDiffGain int
+
+	// The Unix domain socket to listen for commands on, or to send a
+	// command to with --remote.
+	flagSocket string
+
+	// When set, the arguments are sent as a command to the imgv instance
+	// listening on --socket, instead of being opened.
+	flagRemote bool
+
+	// When set, the images are opened by the imgv instance that is already
+	// running on this display, if there is one.
+	flagSingleInstance bool
+
+	// When set, the marked images printed on quit are separated by NUL
+	// bytes instead of newlines.
+	flagNull bool
+
+	// The monitor that the window first appears on, or -1 to let the window
+	// manager decide.
+	flagMonitor int
+
+	// A list of all actions that can be bound to keys. Each value
+	// corresponds to a triple of the name of the action (which is used in
+	// the configuration file), a quick description of what the action does
+	// and the function to run when the action is invoked.
+	actions = []action{
 		{
-			"left", "Cycle to the previous image.",
+			"prev-image", "Cycle to the previous image.",
 			func(w *window) { w.chans.prevImg <- struct{}{} },
 		},
 		{
-			"right", "Cycle to the next image.",
+			"next-image", "Cycle to the next image.",
 			func(w *window) { w.chans.nextImg <- struct{}{} },
 		},
 		{
-			"shift-h", "Cycle to the previous image.",
-			func(w *window) { w.chans.prevImg <- struct{}{} },
+			"resize-to-image", "Resize the window to fit the current image.",
+			func(w *window) { w.chans.resizeToImageChan <- struct{}{} },
 		},
 		{
-			"shift-l", "Cycle to the next image.",
-			func(w *window) { w.chans.nextImg <- struct{}{} },
+			"pan-left", "Pan left.", func(w *window) { w.stepLeft() },
 		},
 		{
-			"r", "Resize the window to fit the current image.",
-			func(w *window) { w.chans.resizeToImageChan <- struct{}{} },
+			"pan-down", "Pan down.", func(w *window) { w.stepDown() },
+		},
+		{
+			"pan-up", "Pan up.", func(w *window) { w.stepUp() },
+		},
+		{
+			"pan-right", "Pan right.", func(w *window) { w.stepRight() },
+		},
+		{
+			"toggle-grid", "Toggle the thumbnail grid.",
+			func(w *window) { w.chans.gridChan <- struct{}{} },
+		},
+		{
+			"open-selected", "Show the image selected in the thumbnail grid.",
+			func(w *window) { w.chans.openChan <- struct{}{} },
 		},
 		{
-			"h", "Pan left.", func(w *window) { w.stepLeft() },
+			"toggle-filmstrip", "Toggle the filmstrip.",
+			func(w *window) { w.chans.stripChan <- struct{}{} },
 		},
 		{
-			"j", "Pan down.", func(w *window) { w.stepDown() },
+			"toggle-info", "Toggle the information overlay.",
+			func(w *window) { w.chans.infoChan <- struct{}{} },
 		},
 		{
-			"k", "Pan up.", func(w *window) { w.stepUp() },
+			"toggle-inspector", "Toggle the pixel inspector.",
+			func(w *window) { w.chans.inspectChan <- struct{}{} },
 		},
 		{
-			"l", "Pan right.", func(w *window) { w.stepRight() },
+			"copy-pixel",
+			"Copy the color of the inspected pixel to the clipboard.",
+			func(w *window) { w.chans.copyChan <- struct{}{} },
 		},
 		{
-			"q", "Quit.", func(w *window) { xevent.Quit(w.X) },
+			"toggle-histogram", "Toggle the histogram panel.",
+			func(w *window) { w.chans.histChan <- struct{}{} },
 		},
+		{
+			"toggle-histogram-region",
+			"Toggle the histogram between the whole image and the visible " +
+				"region.",
+			func(w *window) { w.chans.histRegionChan <- struct{}{} },
+		},
+		{
+			"toggle-resize-each",
+			"Toggle resizing the window to every image shown.",
+			func(w *window) { w.chans.resizeEachChan <- struct{}{} },
+		},
+		{
+			"cycle-backdrop",
+			"Switch to the next backdrop for transparent images.",
+			func(w *window) { w.chans.backdropChan <- struct{}{} },
+		},
+		{
+			"cycle-alpha-mode",
+			"Switch to the next way of showing the alpha channel.",
+			func(w *window) { w.chans.alphaChan <- struct{}{} },
+		},
+		{
+			"toggle-compare",
+			"Toggle comparing the current image with another image.",
+			func(w *window) { w.chans.compareChan <- struct{}{} },
+		},
+		{
+			"toggle-compare-layout",
+			"Toggle comparing images side by side or stacked.",
+			func(w *window) { w.chans.compareLayoutChan <- struct{}{} },
+		},
+		{
+			"swap-compare", "Swap the images being compared.",
+			func(w *window) { w.chans.swapChan <- struct{}{} },
+		},
+		{
+			"cycle-compare-mode",
+			"Switch to the next way of comparing images.",
+			func(w *window) { w.chans.compareModeChan <- struct{}{} },
+		},
+		{
+			"flip-compare",
+			"Show image B while the key is held down, or switch between the " +
+				"images being compared (flicker mode).",
+			func(w *window) { w.chans.flipChan <- struct{}{} },
+		},
+		{
+			"toggle-auto-flip",
+			"Toggle switching between the images being compared on a timer.",
+			func(w *window) { w.chans.autoFlipChan <- struct{}{} },
+		},
+		{
+			"onion-more",
+			"Make the second image more opaque (onion mode).",
+			func(w *window) { w.chans.opacityChan <- 10 },
+		},
+		{
+			"onion-less",
+			"Make the second image more transparent (onion mode).",
+			func(w *window) { w.chans.opacityChan <- -10 },
+		},
+		{
+			"toggle-fullscreen", "Toggle fullscreen mode.",
+			func(w *window) { w.toggleFullscreen() },
+		},
+		{
+			"toggle-mark", "Mark or unmark the current image.",
+			func(w *window) { w.chans.markChan <- "toggle" },
+		},
+		{
+			"mark-all", "Mark every image.",
+			func(w *window) { w.chans.markChan <- "all" },
+		},
+		{
+			"mark-none", "Unmark every image.",
+			func(w *window) { w.chans.markChan <- "none" },
+		},
+		{
+			"invert-marks", "Mark the unmarked images, and unmark the rest.",
+			func(w *window) { w.chans.markChan <- "invert" },
+		},
+		{
+			"rename", "Rename the file of the current image.",
+			func(w *window) { w.chans.renameChan <- struct{}{} },
+		},
+		{
+			"trash", "Move the current image to the trash.",
+			func(w *window) { w.chans.fileChan <- fileOp{kind: "trash"} },
+		},
+		{
+			"undo-trash", "Restore the image moved to the trash last.",
+			func(w *window) { w.chans.fileChan <- fileOp{kind: "undo"} },
+		},
+		{
+			"context-menu", "Open the context menu.",
+			func(w *window) { w.openMenu() },
+		},
+		{
+			"quit", "Quit.", func(w *window) { xevent.Quit(w.X) },
+		},
+	}
+
+	// A list of keybindings. Each value corresponds to a key sequence to
+	// bind to and the name of the action to run when that key sequence is
+	// pressed. These are the defaults, which can be changed in the
+	// configuration file.
+	keybinds = []keyb{
+		{key: "left", action: "prev-image"},
+		{key: "right", action: "next-image"},
+		{key: "shift-h", action: "prev-image"},
+		{key: "shift-l", action: "next-image"},
+		{key: "r", action: "resize-to-image"},
+		{key: "shift-r", action: "toggle-resize-each"},
+		{key: "h", action: "pan-left"},
+		{key: "j", action: "pan-down"},
+		{key: "k", action: "pan-up"},
+		{key: "l", action: "pan-right"},
+		{key: "g", action: "toggle-grid"},
+		{key: "return", action: "open-selected"},
+		{key: "f", action: "toggle-filmstrip"},
+		{key: "i", action: "toggle-info"},
+		{key: "p", action: "toggle-inspector"},
+		{key: "c", action: "copy-pixel"},
+		{key: "s", action: "toggle-histogram"},
+		{key: "shift-s", action: "toggle-histogram-region"},
+		{key: "shift-f", action: "toggle-fullscreen"},
+		{key: "b", action: "cycle-backdrop"},
+		{key: "a", action: "cycle-alpha-mode"},
+		{key: "v", action: "toggle-compare"},
+		{key: "shift-v", action: "toggle-compare-layout"},
+		{key: "w", action: "swap-compare"},
+		{key: "m", action: "cycle-compare-mode"},
+		{key: "space", action: "flip-compare"},
+		{key: "t", action: "toggle-auto-flip"},
+		{key: "equal", action: "onion-more"},
+		{key: "minus", action: "onion-less"},
+		{key: "x", action: "toggle-mark"},
+		{key: "control-a", action: "mark-all"},
+		{key: "control-shift-a", action: "mark-none"},
+		{key: "shift-x", action: "invert-marks"},
+		{key: "f2", action: "rename"},
+		{key: "delete", action: "trash"},
+		{key: "u", action: "undo-trash"},
+		{key: "q", action: "quit"},
+	}
+
+	// A list of mouse bindings. Each value corresponds to a mouse button to
+	// bind to and the name of the action to run when that button is pressed.
+	// "pan" is a special action that pans the image while the button is
+	// held down. Like the keybindings, these can be changed in the
+	// configuration file.
+	// (Buttons 4 and 5 are the scroll wheel, while 8 and 9 are usually the
+	// back and forward buttons.)
+	mousebinds = []mouseb{
+		{button: "1", action: "pan"},
+		{button: "double-1", action: "toggle-fullscreen"},
+		{button: "2", action: "resize-to-image"},
+		{button: "3", action: "context-menu"},
+		{button: "4", action: "prev-image"},
+		{button: "5", action: "next-image"},
+		{button: "8", action: "prev-image"},
+		{button: "9", action: "next-image"},
 	}
 )
 
@@ -97,19 +345,62 @@ func init() {
 		"The initial height of the window.")
 	flag.BoolVar(&flagAutoResize, "auto-resize", false,
 		"If set, window will resize to size of first image.")
+	flag.BoolVar(&flagResizeEach, "resize-each", false,
+		"If set, window will resize to size of every image shown.")
+	flag.StringVar(&flagResizeAnchor, "resize-anchor", "top-left",
+		"What stays in place when resizing to an image: "+
+			"'top-left' or 'center'.")
 	flag.IntVar(&flagStepIncrement, "increment", 20,
 		"The increment (in pixels) used to pan the image.")
 	flag.StringVar(&flagProfile, "profile", "",
 		"If set, a CPU profile will be saved to the file name provided.")
 	flag.BoolVar(&flagKeybindings, "keybindings", false,
 		"If set, imgv will output a list all keybindings.")
+	flag.StringVar(&flagConfig, "config", configPath(),
+		"The configuration file to read.")
+	flag.BoolVar(&flagNoConfig, "no-config", false,
+		"If set, the configuration file will not be read.")
+	flag.BoolVar(&flagFullscreen, "fullscreen", false,
+		"If set, the window will start in fullscreen mode.")
+	flag.StringVar(&flagClass, "class", "Imgv",
+		"The window class (in WM_CLASS) that window manager rules can match.")
+	flag.IntVar(&flagFlickerInterval, "flicker-interval", 500,
+		"The time (in milliseconds) between images when flickering.")
+	flag.IntVar(&flagDiffGain, "diff-gain", 10,
+		"The amount to amplify differences by in the difference heatmap.")
+	flag.StringVar(&flagSocket, "socket", "",
+		"If set, imgv listens for commands on this Unix domain socket.")
+	flag.BoolVar(&flagRemote, "remote", false,
+		"If set, the arguments are sent as a command to the imgv listening "+
+			"on --socket.")
+	flag.BoolVar(&flagSingleInstance, "single-instance", false,
+		"If set, images are opened in the imgv already running on this "+
+			"display.")
+	flag.BoolVar(&flagNull, "null", false,
+		"If set, the marked images printed on quit are separated by NUL "+
+			"bytes instead of newlines.")
+	flag.IntVar(&flagMonitor, "monitor", -1,
+		"The monitor (starting from 0) that the window first appears on.")
+	flag.Var(&flagBackground, "background",
+		"The background color (#rrggbb) of the window.")
+	flag.StringVar(&flagBackdrop, "backdrop", "checker",
+		"What transparent images are shown on: "+
+			"'checker', 'solid' or 'black'.")
+	flag.Var(&flagBackdropColor, "backdrop-color",
+		"The color (#rrggbb) of the solid backdrop.")
+	flag.Var(&flagCheckerLight, "checker-light",
+		"The color (#rrggbb) of the light squares in the checker backdrop.")
+	flag.Var(&flagCheckerDark, "checker-dark",
+		"The color (#rrggbb) of the dark squares in the checker backdrop.")
+	flag.IntVar(&flagCheckerSize, "checker-size", 15,
+		"The size (in pixels) of the squares in the checker backdrop.")
+	flag.Var(&flagFullscreenBg, "fullscreen-bg",
+		"The background color (#rrggbb) of the window in fullscreen mode.")
 	flag.Usage = usage
-	flag.Parse()
 
-	// Do some error checking on the flag values... naughty!
-	if flagWidth == 0 || flagHeight == 0 {
-		errLg.Fatal("The width and height must be non-zero values.")
-	}
+	// The flags are parsed in main, since options in the configuration file
+	// can only be set after we know which flags were given on the command
+	// line.
 }
 
 func usage() {
@@ -120,16 +411,103 @@ func usage() {
 }
 
 func main() {
+	flag.Parse()
+
+	// Load the configuration file before anything else, since it changes
+	// the flags and keybindings. Flags given on the command line take
+	// priority over options set in the configuration file.
+	if !flagNoConfig {
+		flag.Visit(func(f *flag.Flag) { cmdlineFlags[f.Name] = true })
+		if err := loadConfig(flagConfig); err != nil {
+			errLg.Fatal(err)
+		}
+	}
+
+	// Do some error checking on the flag values... naughty!
+	if flagWidth == 0 || flagHeight == 0 {
+		errLg.Fatal("The width and height must be non-zero values.")
+	}
+	if flagResizeAnchor != "top-left" && flagResizeAnchor != "center" {
+		errLg.Fatal("The resize anchor must be 'top-left' or 'center'.")
+	}
+	if !validBackdrop(flagBackdrop) {
+		errLg.Fatal("The backdrop must be 'checker', 'solid' or 'black'.")
+	}
+	if flagCheckerSize < 1 {
+		errLg.Fatal("The checker size must be at least 1.")
+	}
+	if flagFlickerInterval < 1 {
+		errLg.Fatal("The flicker interval must be at least 1 millisecond.")
+	}
+	if flagDiffGain < 1 {
+		errLg.Fatal("The difference gain must be at least 1.")
+	}
+	if flagMonitor < -1 {
+		errLg.Fatal("The monitor must be 0 or greater.")
+	}
+
 	// If we just need the keybindings, print them and be done.
 	if flagKeybindings {
+		bound := make(map[string]bool)
 		for _, keyb := range keybinds {
-			fmt.Printf("%-10s %s\n", keyb.key, keyb.desc)
+			act := findAction(keyb.action)
+			fmt.Printf("%-10s %-24s %s\n", keyb.key, act.name, act.desc)
+			bound[act.name] = true
+		}
+
+		// Show the actions that aren't bound too, so that they can be
+		// found and bound in the configuration file.
+		for _, act := range actions {
+			if !bound[act.name] {
+				fmt.Printf("%-10s %-24s %s\n", "(none)", act.name, act.desc)
+			}
+		}
+		for _, mouseb := range mousebinds {
+			desc := "Pan the image, or show the image clicked on in the " +
+				"thumbnail grid or filmstrip."
+			if act := findAction(mouseb.action); act != nil {
+				desc = act.desc
+			}
+			fmt.Printf("%-10s %-24s %s\n", "mouse-"+mouseb.button,
+				mouseb.action, desc)
 		}
-		fmt.Printf("%-10s %s\n", "mouse",
-			"Left mouse button will pan the image.")
 		os.Exit(0)
 	}
 
+	// If we're just sending a command to another imgv, do that and quit.
+	if flagRemote {
+		if len(flagSocket) == 0 {
+			socket, err := instanceSocket()
+			if err != nil {
+				errLg.Fatalf("Could not find the socket: %s", err)
+			}
+			flagSocket = socket
+		}
+		os.Exit(remote(flagSocket, flag.Args()))
+	}
+
+	// If there's already an imgv running on this display, give it our
+	// images and quit. Otherwise, this is the imgv that others talk to.
+	if flagSingleInstance && len(flagSocket) == 0 {
+		// Without a socket, this imgv just runs on its own.
+		socket, err := instanceSocket()
+		if err != nil {
+			errLg.Printf("Could not find the socket: %s", err)
+		}
+		flagSocket = socket
+	}
+	if flagSingleInstance && len(flagSocket) > 0 && listening(flagSocket) {
+		status := 0
+		if flag.NArg() > 0 {
+			args := append([]string{"open"}, flag.Args()...)
+			status = remote(flagSocket, args)
+		}
+		if status == 0 {
+			status = remote(flagSocket, []string{"raise"})
+		}
+		os.Exit(status)
+	}
+
 	// Run the CPU profile if we're instructed to.
 	if len(flagProfile) > 0 {
 		f, err := os.Create(flagProfile)
@@ -157,8 +535,13 @@ func main() {
 	// something is going on.
 	window := newWindow(X)
 
-	// Decode all images (in parallel).
-	names, imgs := decodeImages(findFiles(flag.Args()))
+	// Open all images (in parallel). They are decoded later, when they're
+	// needed.
+	infos, imgs := openImages(findFiles(flag.Args()))
+	fNames, names := make([]string, len(infos)), make([]string, len(infos))
+	for i, info := range infos {
+		fNames[i], names[i] = info.fName, basename(info.fName)
+	}
 
 	// Die now if we don't have any images!
 	if len(imgs) == 0 {
@@ -166,18 +549,41 @@ func main() {
 	}
 
 	// Auto-size the window if appropriate.
-	if flagAutoResize {
-		window.Resize(imgs[0].Bounds().Dx(), imgs[0].Bounds().Dy())
+	if flagAutoResize || flagResizeEach {
+		window.fitResize(imgs[0].Bounds().Dx(), imgs[0].Bounds().Dy())
 	}
 
 	// Create the canvas and start the image goroutines.
-	chans := canvas(X, window, names, len(imgs))
+	chans := canvas(X, window, names, infos, imgs)
 	for i, img := range imgs {
 		go newImage(X, names[i], img, i, chans.imgLoadChans[i], chans.imgChan)
 	}
 
+	// Generate thumbnails for the grid in the background.
+	go thumbnails(X, fNames, imgs, 0, chans.thumbChan)
+
+	// Listen for commands from other programs.
+	if len(flagSocket) > 0 {
+		l, err := listen(window, flagSocket)
+		switch {
+		case err == nil:
+			defer l.Close()
+		case flagSingleInstance:
+			// Another imgv started at the same time, and won.
+			errLg.Printf("Could not listen on '%s': %s", flagSocket, err)
+		default:
+			errLg.Fatalf("Could not listen on '%s': %s", flagSocket, err)
+		}
+	}
+
 	// Start the main X event loop.
 	xevent.Main(X)
+
+	// Print the marked images, so that imgv can be used to pick images.
+	// (i.e., 'imgv *.jpg | xargs mv -t keep/')
+	reply := make(chan []string)
+	chans.marksChan <- reply
+	printMarks(<-reply)
 }
 
 func findFiles(args []string) []string {
@@ -209,18 +615,21 @@ func dirImages(dir string) []string {
 	return files
 }
 
-// decodeImages takes a list of image files and decodes them into image.Image
-// types. Note that the number of images returned may not be the number of
+// openImages takes a list of image files and reads the header of each one,
+// which is enough to know its size. The images are returned as lazyImage
+// values, which aren't decoded until their pixels are needed. Information
+// about each image (including its file name) is returned along with the
+// images. Note that the number of images returned may not be the number of
 // image files passed in. Namely, an image file is skipped if it cannot be
-// read or deocoded into an image type that Go understands.
-func decodeImages(imageFiles []string) ([]string, []image.Image) {
-	// A temporary type used to transport decoded images over channels.
+// read or isn't in an image format that Go understands.
+func openImages(imageFiles []string) ([]imgInfo, []image.Image) {
+	// A temporary type used to transport opened images over channels.
 	type tmpImage struct {
 		img  image.Image
-		name string
+		info imgInfo
 	}
 
-	// Decoded all images specified in parallel.
+	// Read all images specified in parallel.
 	imgChans := make([]chan tmpImage, len(imageFiles))
 	for i, fName := range imageFiles {
 		imgChans[i] = make(chan tmpImage, 0)
@@ -231,35 +640,34 @@ func decodeImages(imageFiles []string) ([]string, []image.Image) {
 				close(imgChans[i])
 				return
 			}
+			defer file.Close()
 
-			start := time.Now()
-			img, kind, err := image.Decode(file)
+			config, kind, err := image.DecodeConfig(file)
 			if err != nil {
 				errLg.Printf("Could not decode '%s' into a supported image "+
 					"format: %s", fName, err)
 				close(imgChans[i])
 				return
 			}
-			lg("Decoded '%s' into image type '%s' (%s).",
-				fName, kind, time.Since(start))
 
+			img := &lazyImage{fName: fName, config: config}
 			imgChans[i] <- tmpImage{
 				img:  img,
-				name: basename(fName),
+				info: newInfo(fName, kind, img),
 			}
 		}(i, fName)
 	}
 
-	// Now collect all the decoded images into a slice of names and a slice
-	// of images.
-	names := make([]string, 0, flag.NArg())
-	imgs := make([]image.Image, 0, flag.NArg())
+	// Now collect all the opened images into a slice of image information
+	// and a slice of images.
+	infos := make([]imgInfo, 0, len(imageFiles))
+	imgs := make([]image.Image, 0, len(imageFiles))
 	for _, imgChan := range imgChans {
 		if tmpImg, ok := <-imgChan; ok {
-			names = append(names, tmpImg.name)
+			infos = append(infos, tmpImg.info)
 			imgs = append(imgs, tmpImg.img)
 		}
 	}
 
-	return names, imgs
+	return infos, imgs
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// markColor is the color of the marker on marked thumbnails in the grid.
+const markColor = 0xffaa00
+
+// markSize is the width and height (in pixels) of the marker on marked
+// thumbnails in the grid.
+const markSize = 10
+
+// mark changes which images are marked. op is one of "toggle" (which only
+// changes the image at index i), "all", "none" or "invert".
+func mark(marked []bool, i int, op string) {
+	if op == "toggle" {
+		marked[i] = !marked[i]
+		return
+	}
+	for j := range marked {
+		marked[j] = op == "all" || (op == "invert" && !marked[j])
+	}
+}
+
+// countMarked returns the number of marked images.
+func countMarked(marked []bool) int {
+	n := 0
+	for _, m := range marked {
+		if m {
+			n++
+		}
+	}
+	return n
+}
+
+// drawMark tells the user that the current image is marked, in the
+// bottom-right corner of the viewport.
+func drawMark(win *window) {
+	lines := []string{"Marked"}
+	vw, vh := win.viewport()
+	width, height := win.textSize(lines)
+	win.text(vw-width, vh-height, lines)
+}
+
+// markedFiles returns the absolute file names of the marked images, in the
+// order of the list.
+func markedFiles(infos []imgInfo, marked []bool) []string {
+	fNames := []string{}
+	for i, info := range infos {
+		if !marked[i] {
+			continue
+		}
+		fName := info.fName
+		if abs, err := filepath.Abs(fName); err == nil {
+			fName = abs
+		}
+		fNames = append(fNames, fName)
+	}
+	return fNames
+}
+
+// printMarks prints the file names of the marked images to stdout, each
+// followed by a newline (or a NUL byte, with --null).
+func printMarks(fNames []string) {
+	sep := "\n"
+	if flagNull {
+		sep = "\x00"
+	}
+	for _, fName := range fNames {
+		fmt.Fprint(os.Stdout, fName+sep)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"image"
+	"strings"
+)
+
+// menuActions is the list of actions, in order, that are shown in the
+// context menu.
+var menuActions = []string{
+	"prev-image",
+	"next-image",
+	"resize-to-image",
+	"toggle-grid",
+	"toggle-filmstrip",
+	"toggle-info",
+	"toggle-inspector",
+	"toggle-histogram",
+	"toggle-compare",
+	"toggle-mark",
+	"rename",
+	"toggle-fullscreen",
+	"quit",
+}
+
+// menu keeps the state of the context menu, which is drawn on top of the
+// current image. It is only ever touched by the canvas goroutine.
+type menu struct {
+	// active is true when the context menu is shown.
+	active bool
+
+	// pos is the top-left corner of the menu in window coordinates.
+	pos image.Point
+
+	// selected is the index of the item under the pointer, or -1.
+	selected int
+}
+
+// open shows the menu with its top-left corner at pt. The menu is moved
+// (if necessary) so that all of it fits in the window.
+func (m *menu) open(win *window, pt image.Point) {
+	width, height := win.textSize(m.lines())
+	m.active, m.selected = true, -1
+	m.pos = image.Point{
+		max(0, min(pt.X, win.Geom.Width()-width)),
+		max(0, min(pt.Y, win.Geom.Height()-height)),
+	}
+}
+
+// lines returns the text of each item in the menu.
+func (m *menu) lines() []string {
+	lines := make([]string, len(menuActions))
+	for i, name := range menuActions {
+		lines[i] = strings.TrimSuffix(findAction(name).desc, ".")
+	}
+	return lines
+}
+
+// itemAt returns the index of the item under the point pt (in window
+// coordinates), or -1 if pt isn't over an item.
+func (m *menu) itemAt(win *window, pt image.Point) int {
+	width, height := win.textSize(m.lines())
+	if !pt.In(image.Rect(m.pos.X, m.pos.Y, m.pos.X+width, m.pos.Y+height)) {
+		return -1
+	}
+	i := (pt.Y - m.pos.Y - textPad) / win.lineHeight
+	if i < 0 || i >= len(menuActions) {
+		return -1
+	}
+	return i
+}
+
+// hover selects the item under the point pt, and returns true if the
+// selection changed.
+func (m *menu) hover(win *window, pt image.Point) bool {
+	i := m.itemAt(win, pt)
+	changed := i != m.selected
+	m.selected = i
+	return changed
+}
+
+// draw paints the menu with the selected item outlined.
+func (m *menu) draw(win *window) {
+	if !m.active {
+		return
+	}
+	box := win.text(m.pos.X, m.pos.Y, m.lines())
+	if m.selected > -1 {
+		y := box.Min.Y + textPad + m.selected*win.lineHeight
+		win.outline(image.Rect(box.Min.X, y-1,
+			box.Max.X, y+win.lineHeight+1))
+	}
+}
+
+// choose closes the menu and runs the action under the point pt, if there is
+// one. The action is run in its own goroutine, since actions communicate
+// with the canvas (which is probably the caller).
+func (m *menu) choose(win *window, pt image.Point) {
+	i := m.itemAt(win, pt)
+	m.active = false
+	if i > -1 {
+		go findAction(menuActions[i]).run(win)
+	}
+}
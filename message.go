@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/BurntSushi/xgbutil/xprop"
+)
+
+// Besides the socket, imgv can be controlled by sending a ClientMessage
+// event of type _IMGV_COMMAND to its window. The commands are the same as
+// the socket's (see remote.go), and are given in one of two ways:
+//
+//	format 8
+//		The data is the command itself, padded with NUL bytes. (Which
+//		limits it to 20 bytes.)
+//	format 32
+//		The first value is an atom whose name is the command. (For commands
+//		that don't fit in 20 bytes, like "open" with a long file name.)
+//
+// Since there's no way to reply to a ClientMessage, errors are only
+// reported on stderr. Instead of the "current" command, other clients can
+// read the _IMGV_CURRENT_FILE (UTF8_STRING) and _IMGV_INDEX (CARDINAL)
+// properties on the window, which hold the absolute file name and the index
+// (starting at 1) of the image being shown.
+
+// clientMessage runs the command in an _IMGV_COMMAND ClientMessage event.
+// Other ClientMessage events are ignored.
+func (w *window) clientMessage(X *xgbutil.XUtil,
+	ev xevent.ClientMessageEvent) {
+
+	typ, err := xprop.AtomName(X, ev.Type)
+	if err != nil || typ != "_IMGV_COMMAND" {
+		return
+	}
+
+	var line string
+	switch ev.Format {
+	case 8:
+		data := ev.Data.Data8
+		if i := bytes.IndexByte(data, 0); i > -1 {
+			data = data[:i]
+		}
+		line = string(data)
+	case 32:
+		line, err = xprop.AtomName(X, xproto.Atom(ev.Data.Data32[0]))
+		if err != nil {
+			errLg.Printf("Could not get the name of an _IMGV_COMMAND "+
+				"atom: %s", err)
+			return
+		}
+	default:
+		errLg.Printf("_IMGV_COMMAND has an unsupported format (%d).",
+			ev.Format)
+		return
+	}
+
+	// Commands talk to the canvas, which may be waiting on the X event loop.
+	go func() {
+		if _, err := w.command(line); err != nil {
+			errLg.Printf("Could not run '%s': %s", line, err)
+		} else if quits(line) {
+			w.quit()
+		}
+	}()
+}
+
+// currentSet publishes the index and file name of the image being shown in
+// the _IMGV_INDEX and _IMGV_CURRENT_FILE properties. The properties are only
+// changed when the image does, since this is called whenever the canvas
+// paints an image (i.e., while panning).
+func (w *window) currentSet(index int, fName string) {
+	if index == w.shownIndex && fName == w.shownFile {
+		return
+	}
+	w.shownIndex, w.shownFile = index, fName
+
+	if abs, err := filepath.Abs(fName); err == nil {
+		fName = abs
+	}
+	err := xprop.ChangeProp(w.X, w.Id, 8, "_IMGV_CURRENT_FILE",
+		"UTF8_STRING", []byte(fName))
+	if err != nil { // not a fatal error
+		lg("Could not set _IMGV_CURRENT_FILE: %s", err)
+	}
+	err = xprop.ChangeProp32(w.X, w.Id, "_IMGV_INDEX", "CARDINAL",
+		uint(index+1))
+	if err != nil { // not a fatal error
+		lg("Could not set _IMGV_INDEX: %s", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"image"
+
+	xinit "github.com/BurntSushi/xgb/xinerama"
+
+	"github.com/BurntSushi/xgbutil/ewmh"
+	"github.com/BurntSushi/xgbutil/xrect"
+)
+
+// initMonitors loads the Xinerama extension, which is used to find the
+// geometry of each monitor. (RandR servers provide Xinerama too.) If it isn't
+// available, the whole screen is treated as a single monitor.
+func (w *window) initMonitors() {
+	if err := xinit.Init(w.X.Conn()); err != nil {
+		lg("Could not initialize Xinerama: %s", err)
+		return
+	}
+	w.xinerama = true
+}
+
+// monitors returns the geometry of each monitor, in the order that Xinerama
+// reports them. This is the order used by --monitor, and by window managers
+// for _NET_WM_FULLSCREEN_MONITORS, so the monitors are neither sorted nor
+// is any of them dropped. (Monitors that clone another one are listed
+// too.)
+func (w *window) monitors() []xrect.Rect {
+	if w.xinerama {
+		reply, err := xinit.QueryScreens(w.X.Conn()).Reply()
+		if err == nil && len(reply.ScreenInfo) > 0 {
+			heads := make([]xrect.Rect, len(reply.ScreenInfo))
+			for i, info := range reply.ScreenInfo {
+				heads[i] = xrect.New(int(info.XOrg), int(info.YOrg),
+					int(info.Width), int(info.Height))
+			}
+			return heads
+		}
+		lg("Could not query monitors: %s", err)
+	}
+	screen := w.X.Screen()
+	return []xrect.Rect{xrect.New(0, 0,
+		int(screen.WidthInPixels), int(screen.HeightInPixels))}
+}
+
+// monitor returns the index and geometry of the monitor that most of the
+// window is on.
+func (w *window) monitor() (int, xrect.Rect) {
+	heads := w.monitors()
+	geom, err := w.DecorGeometry()
+	if err != nil {
+		return 0, heads[0]
+	}
+	i := xrect.LargestOverlap(geom, heads)
+	if i < 0 {
+		i = 0
+	}
+	return i, heads[i]
+}
+
+// workArea returns the part of the monitor head that isn't taken up by
+// panels and docks. _NET_WORKAREA only describes a single rectangle for all
+// monitors, so this is only an approximation when the panels aren't on the
+// edges of the whole screen.
+func (w *window) workArea(head xrect.Rect) xrect.Rect {
+	desktop, err := ewmh.CurrentDesktopGet(w.X)
+	if err != nil {
+		return head
+	}
+	areas, err := ewmh.WorkareaGet(w.X)
+	if err != nil || int(desktop) >= len(areas) {
+		return head
+	}
+	area := areas[desktop]
+	x1, y1 := max(head.X(), area.X), max(head.Y(), area.Y)
+	x2 := min(head.X()+head.Width(), area.X+int(area.Width))
+	y2 := min(head.Y()+head.Height(), area.Y+int(area.Height))
+	if x2 <= x1 || y2 <= y1 {
+		return head
+	}
+	return xrect.New(x1, y1, x2-x1, y2-y1)
+}
+
+// placement returns the geometry the window should first have: centered on
+// the monitor given by --monitor, or on the first monitor otherwise. Either
+// way, the window is no bigger than the work area of that monitor. The
+// position should only be used if --monitor was given, which is reported by
+// the second return value. (Otherwise, the window manager places it.)
+func (w *window) placement() (xrect.Rect, bool) {
+	heads := w.monitors()
+	head := heads[0]
+	if flagMonitor >= len(heads) {
+		errLg.Fatalf("There is no monitor %d. (There are %d monitors, "+
+			"starting from 0.)", flagMonitor, len(heads))
+	} else if flagMonitor >= 0 {
+		head = heads[flagMonitor]
+	}
+
+	area := w.workArea(head)
+	width := min(flagWidth, area.Width())
+	height := min(flagHeight, area.Height())
+	return xrect.New(area.X()+(area.Width()-width)/2,
+		area.Y()+(area.Height()-height)/2, width, height), flagMonitor >= 0
+}
+
+// frame returns the work area of the monitor that the window is on, the
+// geometry of the window including its frame, and the size of the frame that
+// the window manager put around the window.
+func (w *window) frame() (area, decor xrect.Rect, fw, fh int) {
+	_, head := w.monitor()
+	area = w.workArea(head)
+	decor, err := w.DecorGeometry()
+	if err != nil {
+		decor = xrect.New(w.Geom.Pieces())
+	}
+	fw, fh = decor.Width()-w.Geom.Width(), decor.Height()-w.Geom.Height()
+	return area, decor, fw, fh
+}
+
+// maxViewport returns the biggest size that the viewport can have without
+// making the window bigger than the work area of the monitor it is on.
+func (w *window) maxViewport() image.Point {
+	area, _, fw, fh := w.frame()
+	return image.Pt(max(1, area.Width()-fw),
+		max(1, area.Height()-fh-w.stripHeight))
+}
+
+// fitResize resizes the window to width and height, but never makes it
+// bigger than the work area of the monitor it is on. If it has to be made
+// smaller, it keeps its aspect ratio (not counting the filmstrip), just like
+// the window manager is asked to. (See hintsSet.) Either the top-left
+// corner or the center of the window stays where it is, depending on
+// --resize-anchor. The window is moved if it would hang off the edge of the
+// work area. Fullscreen windows are left alone.
+func (w *window) fitResize(width, height int) {
+	if w.isFullscreen() {
+		return
+	}
+	area, decor, fw, fh := w.frame()
+	box := image.Pt(max(1, area.Width()-fw),
+		max(1, area.Height()-fh-w.stripHeight))
+	size, _ := fitSize(image.Pt(width, max(1, height-w.stripHeight)), box)
+	width, height = size.X, size.Y+w.stripHeight
+
+	x, y := decor.X(), decor.Y()
+	if flagResizeAnchor == "center" {
+		x += (decor.Width() - width - fw) / 2
+		y += (decor.Height() - height - fh) / 2
+	}
+	x = max(area.X(), min(x, area.X()+area.Width()-width-fw))
+	y = max(area.Y(), min(y, area.Y()+area.Height()-height-fh))
+	if x == decor.X() && y == decor.Y() {
+		w.Resize(width, height)
+	} else {
+		w.WMMoveResize(x, y, width+fw, height+fh)
+	}
+}
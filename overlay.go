@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// overlay keeps the state of the information overlay, which is drawn on top
+// of the top-left corner of the current image. It is only ever touched by
+// the canvas goroutine.
+type overlay struct {
+	// active is true when the overlay is shown.
+	active bool
+
+	// alpha is the alpha mode that images are shown in.
+	alpha string
+
+	// marked is true when the image is marked, and nmarked is the number
+	// of marked images.
+	marked  bool
+	nmarked int
+
+	// stats are extra lines describing the comparison of two images, if
+	// any.
+	stats []string
+
+	// zoom is the scale (as a percentage) that the image is shown at.
+	zoom int
+}
+
+// draw paints information about the image at index (of total images) on
+// top of the window.
+func (o *overlay) draw(win *window, info imgInfo, index, total int) {
+	if !o.active {
+		return
+	}
+	lines := infoLines(info, index, total, o.zoom)
+	if len(o.alpha) > 0 && o.alpha != "normal" {
+		lines = append(lines, fmt.Sprintf("Alpha mode: %s", o.alpha))
+	}
+	if o.marked || o.nmarked > 0 {
+		yes := "no"
+		if o.marked {
+			yes = "yes"
+		}
+		lines = append(lines, fmt.Sprintf("Marked: %s (%d of %d marked)",
+			yes, o.nmarked, total))
+	}
+	lines = append(lines, o.stats...)
+	win.text(0, 0, lines)
+}
+
+// infoLines returns the lines of text in the information overlay, starting
+// with the absolute file name of the image. zoom is the scale that the
+// image is shown at, as a percentage. (Images are only ever scaled down to
+// fit in the work area. See fitImage.)
+func infoLines(info imgInfo, index, total, zoom int) []string {
+	fName := info.fName
+	if abs, err := filepath.Abs(fName); err == nil {
+		fName = abs
+	}
+	lines := []string{
+		fName,
+		fmt.Sprintf("Image %d of %d", index+1, total),
+		fmt.Sprintf("%dx%d %s, %s", info.width, info.height, info.kind,
+			info.model),
+		fmt.Sprintf("File size: %s", humanSize(info.size)),
+		fmt.Sprintf("Zoom: %d%%", zoom),
+	}
+	if len(info.exif.camera) > 0 {
+		lines = append(lines, fmt.Sprintf("Camera: %s", info.exif.camera))
+	}
+	if len(info.exif.exposure) > 0 {
+		lines = append(lines,
+			fmt.Sprintf("Exposure: %s", info.exif.exposure))
+	}
+	if len(info.exif.date) > 0 {
+		lines = append(lines, fmt.Sprintf("Date: %s", info.exif.date))
+	}
+	return lines
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"image"
+	"sync"
+	"unicode"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+// prompt is a line of text that the user types into, drawn along the bottom
+// of the viewport. While the prompt is open, key presses edit its text
+// instead of running the actions bound to them. The prompt is edited by the
+// X event loop and drawn by the canvas, so it is protected by a mutex.
+type prompt struct {
+	sync.Mutex
+
+	// active is true when the prompt is open.
+	active bool
+
+	// label is shown before the text, and cursor is the position in text
+	// that characters are inserted at.
+	label  string
+	text   []rune
+	cursor int
+
+	// done is called with the text when Return is pressed. (It isn't
+	// called when the prompt is cancelled with Escape.)
+	done func(text string)
+
+	// handled is the sequence number of the last key press handled by the
+	// prompt, so that the key that closes the prompt doesn't run an action
+	// too.
+	handled uint16
+}
+
+// openPrompt opens the prompt with the given label and initial text. done
+// is called (by the X event loop) with the text when it's entered.
+func (w *window) openPrompt(label, text string, done func(text string)) {
+	w.prompt.Lock()
+	w.prompt.active = true
+	w.prompt.label = label
+	w.prompt.text = []rune(text)
+	w.prompt.cursor = len(w.prompt.text)
+	w.prompt.done = done
+	w.prompt.Unlock()
+}
+
+// promptOpen returns true if the prompt is open.
+func (w *window) promptOpen() bool {
+	w.prompt.Lock()
+	defer w.prompt.Unlock()
+	return w.prompt.active
+}
+
+// promptHandled returns true if the key press ev was (or will be) handled
+// by the prompt, in which case no action should be run for it.
+func (w *window) promptHandled(ev xevent.KeyPressEvent) bool {
+	w.prompt.Lock()
+	defer w.prompt.Unlock()
+	return w.prompt.active || w.prompt.handled == ev.Sequence
+}
+
+// promptKey edits the text of the prompt, if it's open, with the key press
+// ev. The usual line editing keys work: Left, Right, Home, End, BackSpace
+// and Delete, as well as Control-a, Control-e, Control-u and Control-k.
+// Return enters the text, and Escape closes the prompt without entering it.
+func (w *window) promptKey(X *xgbutil.XUtil, ev xevent.KeyPressEvent) {
+	p := &w.prompt
+	p.Lock()
+	if !p.active {
+		p.Unlock()
+		return
+	}
+	p.handled = ev.Sequence
+
+	key := keybind.LookupString(X, ev.State, ev.Detail)
+	if ev.State&xproto.ModMaskControl > 0 {
+		key = "control-" + key
+	}
+	closed, entered := false, false
+	switch key {
+	case "Return", "KP_Enter":
+		closed, entered = true, true
+	case "Escape":
+		closed = true
+	case "Left", "control-b":
+		p.cursor = max(0, p.cursor-1)
+	case "Right", "control-f":
+		p.cursor = min(len(p.text), p.cursor+1)
+	case "Home", "control-a":
+		p.cursor = 0
+	case "End", "control-e":
+		p.cursor = len(p.text)
+	case "BackSpace", "control-h":
+		if p.cursor > 0 {
+			p.text = append(p.text[:p.cursor-1], p.text[p.cursor:]...)
+			p.cursor--
+		}
+	case "Delete", "control-d":
+		if p.cursor < len(p.text) {
+			p.text = append(p.text[:p.cursor], p.text[p.cursor+1:]...)
+		}
+	case "control-u":
+		p.text, p.cursor = p.text[p.cursor:], 0
+	case "control-k":
+		p.text = p.text[:p.cursor]
+	default:
+		r := keyRune(X, ev)
+		if r == 0 || ev.State&xproto.ModMaskControl > 0 {
+			break
+		}
+		p.text = append(p.text[:p.cursor],
+			append([]rune{r}, p.text[p.cursor:]...)...)
+		p.cursor++
+	}
+	text, done := string(p.text), p.done
+	if closed {
+		p.active, p.done = false, nil
+	}
+	p.Unlock()
+
+	switch {
+	case entered:
+		done(text)
+	case closed:
+		// The prompt has to be cleared from the window.
+		w.chans.geomChan <- struct{}{}
+	default:
+		w.chans.drawChan <- func(origin image.Point) image.Point {
+			return origin
+		}
+	}
+}
+
+// keyRune returns the character typed by the key press ev, or 0 if it
+// doesn't type one. The keysyms of Latin-1 characters are the characters
+// themselves, while other Unicode characters are 0x01000000 plus the
+// character.
+func keyRune(X *xgbutil.XUtil, ev xevent.KeyPressEvent) rune {
+	ks := keybind.KeysymGet(X, ev.Detail, 0)
+	shifted := keybind.KeysymGet(X, ev.Detail, 1)
+
+	// Caps lock only shifts letters.
+	shift := ev.State&xproto.ModMaskShift > 0
+	if ev.State&xproto.ModMaskLock > 0 && unicode.IsLower(rune(ks)) {
+		shift = !shift
+	}
+	if shift && shifted != 0 {
+		ks = shifted
+	}
+
+	switch {
+	case ks >= 0x20 && ks <= 0x7e, ks >= 0xa0 && ks <= 0xff:
+		return rune(ks)
+	case ks&0xff000000 == 0x01000000:
+		return rune(ks & 0xffffff)
+	}
+	return 0
+}
+
+// drawPrompt draws the prompt (if it's open) along the bottom of the
+// viewport, with a cursor where characters are inserted.
+func (w *window) drawPrompt() {
+	w.prompt.Lock()
+	defer w.prompt.Unlock()
+	if !w.prompt.active {
+		return
+	}
+
+	line := w.prompt.label + string(w.prompt.text)
+	vw, vh := w.viewport()
+	_, height := w.textSize([]string{line})
+	box := w.text(0, vh-height, []string{line})
+	w.fill(image.Rect(box.Max.X, box.Min.Y, vw, box.Max.Y), 0x000000)
+
+	x := textPad + w.charWidth*len([]rune(w.prompt.label))
+	x += w.charWidth * w.prompt.cursor
+	w.fill(image.Rect(x, box.Min.Y+textPad, x+2,
+		box.Min.Y+textPad+w.lineHeight), 0x3399ff)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/BurntSushi/xgbutil/ewmh"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+// imgv can be controlled by other programs through a Unix domain socket,
+// given by --socket. Each line sent to the socket is a command, and imgv
+// replies to each command with a single line: "ok", "ok " followed by some
+// data, or "error " followed by a message. The commands are:
+//
+//	next, prev
+//		Show the next or previous image.
+//	goto N
+//		Show image N. (The first image is 1.)
+//	open FILE
+//		Add FILE to the end of the list and show it.
+//	add FILE
+//		Add FILE to the end of the list without showing it.
+//	current
+//		Reply with the index of the current image, the number of images and
+//		the file name of the current image, separated by spaces.
+//	raise
+//		Ask the window manager to raise and focus the window.
+//	action NAME
+//		Run the action named NAME. (Run 'imgv --keybindings' to see the
+//		names of the actions.)
+//	quit
+//		Quit.
+//
+// File names must be absolute, since imgv may be running in a different
+// directory. (imgv --remote takes care of this.)
+
+// instanceSocket returns the socket used by --single-instance (and by
+// --remote, when --socket isn't given) for the X display in $DISPLAY. This is
+// "$XDG_RUNTIME_DIR/imgv-DISPLAY.sock", or a directory only readable by the
+// user in the temporary directory if $XDG_RUNTIME_DIR isn't set.
+// Since anyone can create that directory first, it is only used if it's
+// owned by the user and nobody else can use it.
+func instanceSocket() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if len(dir) == 0 {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("imgv-%d", os.Getuid()))
+		if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			return "", err
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !fi.IsDir() || fi.Mode().Perm() != 0700 || !ok ||
+			int(st.Uid) != os.Getuid() {
+
+			return "", fmt.Errorf("'%s' must be a directory owned by you "+
+				"with mode 0700.", dir)
+		}
+	}
+	display := strings.Replace(os.Getenv("DISPLAY"), "/", "_", -1)
+	return filepath.Join(dir, fmt.Sprintf("imgv-%s.sock", display)), nil
+}
+
+// listening returns true if an imgv instance is listening on the socket at
+// path.
+func listening(path string) bool {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// listen starts listening for commands on the Unix domain socket at path,
+// and handles each connection in its own goroutine. If the socket file
+// exists but nothing is listening on it (i.e., imgv crashed), it is replaced.
+func listen(w *window, path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if listening(path) {
+			return nil, fmt.Errorf("Something is already listening on "+
+				"'%s'.", path)
+		}
+		lg("Removing stale socket '%s'.", path)
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				lg("Stopped listening on '%s': %s", path, err)
+				return
+			}
+			go w.serve(conn)
+		}
+	}()
+	return l, nil
+}
+
+// serve reads commands from conn, one per line, and replies to each one.
+func (w *window) serve(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		reply, err := w.command(line)
+		if err != nil {
+			fmt.Fprintf(conn, "error %s\n", err)
+		} else if len(reply) > 0 {
+			fmt.Fprintf(conn, "ok %s\n", reply)
+		} else {
+			fmt.Fprintln(conn, "ok")
+		}
+
+		// Quitting is left until the reply has been written, since imgv
+		// may exit as soon as the event loop stops.
+		if err == nil && quits(line) {
+			w.quit()
+			return
+		}
+	}
+}
+
+// splitCommand splits a command line into the name of the command and its
+// argument.
+func splitCommand(line string) (name, arg string) {
+	name = line
+	if i := strings.IndexAny(line, " \t"); i > -1 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return name, arg
+}
+
+// quits returns true if the command line is "quit" or "action quit". These
+// commands don't quit by themselves; whoever runs them calls quit after
+// replying.
+func quits(line string) bool {
+	name, arg := splitCommand(line)
+	return name == "quit" || (name == "action" && arg == "quit")
+}
+
+// command runs a single command and returns its reply. Commands are turned
+// into the same channel messages that keybindings send to the canvas.
+// (See quits for the commands that quit.)
+func (w *window) command(line string) (string, error) {
+	name, arg := splitCommand(line)
+	switch name {
+	case "next":
+		w.chans.nextImg <- struct{}{}
+	case "prev":
+		w.chans.prevImg <- struct{}{}
+	case "goto":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("'%s' is not an image number.", arg)
+		}
+		w.chans.gotoChan <- n - 1
+	case "open", "add":
+		if !filepath.IsAbs(arg) {
+			return "", fmt.Errorf("'%s' is not an absolute file name.", arg)
+		}
+		infos, decoded := openImages(findFiles([]string{arg}))
+		if len(infos) == 0 {
+			return "", fmt.Errorf("Could not open '%s'.", arg)
+		}
+		w.chans.addChan <- added{infos, decoded, name == "open"}
+	case "current":
+		reply := make(chan shown)
+		w.chans.shownChan <- reply
+		cur := <-reply
+		return fmt.Sprintf("%d %d %s", cur.index+1, cur.total, cur.fName),
+			nil
+	case "action":
+		act := findAction(arg)
+		if act == nil {
+			return "", fmt.Errorf("Unknown action '%s'.", arg)
+		}
+		if act.name != "quit" {
+			act.run(w)
+		}
+	case "raise":
+		if err := ewmh.ActiveWindowReq(w.X, w.Id); err != nil {
+			return "", err
+		}
+	case "quit":
+		// The caller quits, after replying. (See quits.)
+	case "zoom":
+		// The only zooming that imgv does is scaling images down to fit
+		// in the work area, when the window follows the size of each image.
+		reply := make(chan shown)
+		w.chans.shownChan <- reply
+		fit := (<-reply).resizeEach
+		switch arg {
+		case "":
+		case "fit", "full", "toggle":
+			if arg == "toggle" || fit != (arg == "fit") {
+				w.chans.resizeEachChan <- struct{}{}
+				fit = !fit
+			}
+		default:
+			return "", fmt.Errorf("'zoom' expects 'fit', 'full' or "+
+				"'toggle', but got '%s'.", arg)
+		}
+		if fit {
+			return "fit", nil
+		}
+		return "full", nil
+	default:
+		return "", fmt.Errorf("Unknown command '%s'.", name)
+	}
+	return "", nil
+}
+
+// quit stops the main event loop from outside of it. The loop only notices
+// when it gets an event, so the window's name is changed to make sure it
+// gets one (a PropertyNotify event).
+func (w *window) quit() {
+	xevent.Quit(w.X)
+	w.nameSet("Quitting...")
+}
+
+// remote sends the command in args (i.e., "next" or "open a.png b.png") to
+// the imgv instance listening on the socket at path, and prints the replies.
+// File names are made absolute, and opening several files sends an "open"
+// command for the first one and an "add" command for each of the rest.
+// The exit status is returned.
+func remote(path string, args []string) int {
+	if len(args) == 0 {
+		errLg.Println("No command given to send.")
+		return 1
+	}
+
+	var lines []string
+	switch args[0] {
+	case "open", "add":
+		if len(args) == 1 {
+			errLg.Printf("No files given to %s.", args[0])
+			return 1
+		}
+		for i, fName := range args[1:] {
+			abs, err := filepath.Abs(fName)
+			if err != nil {
+				errLg.Println(err)
+				return 1
+			}
+			if i == 0 {
+				lines = append(lines, args[0]+" "+abs)
+			} else {
+				lines = append(lines, "add "+abs)
+			}
+		}
+	default:
+		lines = []string{strings.Join(args, " ")}
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		errLg.Println(err)
+		return 1
+	}
+	defer conn.Close()
+
+	status := 0
+	replies := bufio.NewReader(conn)
+	for _, line := range lines {
+		fmt.Fprintln(conn, line)
+		reply, err := replies.ReadString('\n')
+		if err == io.EOF && len(reply) == 0 {
+			errLg.Println("imgv closed the connection without replying.")
+			return 1
+		} else if err != nil && err != io.EOF {
+			errLg.Println(err)
+			return 1
+		}
+		reply = strings.TrimSpace(reply)
+		switch {
+		case strings.HasPrefix(reply, "ok "):
+			fmt.Println(strings.TrimPrefix(reply, "ok "))
+		case reply == "ok":
+		default:
+			errLg.Println(strings.TrimPrefix(reply, "error "))
+			status = 1
+		}
+	}
+	return status
+}
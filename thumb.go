@@ -0,0 +1,148 @@
+package main
+
+import (
+	"image"
+	"runtime"
+	"time"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xgraphics"
+)
+
+// thumbSize is the maximum width and height of a thumbnail.
+const thumbSize = 128
+
+// thumbLoaded is the kind of value sent from the thumbnail goroutine when
+// a thumbnail has been generated and drawn to an X pixmap.
+type thumbLoaded struct {
+	// img is at most thumbSize pixels wide and tall.
+	img *xgraphics.Image
+
+	// small is at most stripThumbSize pixels wide and tall.
+	small *xgraphics.Image
+
+	// index is where the image was in the list, and decoded is the decoded
+	// image that the thumbnail was made from. (The image may have moved
+	// since.)
+	index   int
+	decoded image.Image
+}
+
+// thumbnails is meant to be run as a single goroutine that generates a
+// thumbnail for each image, in order, and sends each one to the canvas as it
+// finishes. fNames should contain the file name of each image, and first is
+// the index of the first image in the canvas' list.
+// Thumbnails are read from the freedesktop.org thumbnail cache when possible,
+// without decoding the image. Otherwise, they are generated from the decoded
+// image and saved to the cache. (An image that is decoded just for its
+// thumbnail isn't kept, since it may never be shown.)
+// This is kept entirely separate from the full image conversion done in
+// newImage. Since Go doesn't let us set goroutine priorities, we get "low
+// priority" by doing all of the work in one goroutine (instead of one per
+// image) and yielding the processor before each thumbnail.
+func thumbnails(X *xgbutil.XUtil, fNames []string, imgs []image.Image,
+	first int, thumbChan chan thumbLoaded) {
+
+	for i, img := range imgs {
+		runtime.Gosched()
+
+		start := time.Now()
+		thumb, err := cachedThumb(fNames[i])
+		if err != nil {
+			lg("No cached thumbnail for '%s': %s", fNames[i], err)
+			src := img
+			if l, ok := img.(*lazyImage); ok {
+				src = l.decode(false)
+			}
+			thumb = cacheThumbs(fNames[i], src)
+		}
+
+		reg, err := thumbPixmap(X, thumb)
+		if err != nil {
+			// A missing thumbnail isn't worth dying over.
+			errLg.Println(err)
+			continue
+		}
+		small, err := thumbPixmap(X, scaleDown(thumb, stripThumbSize))
+		if err != nil {
+			errLg.Println(err)
+			continue
+		}
+		lg("Generated thumbnail %d (%s).", i, time.Since(start))
+
+		thumbChan <- thumbLoaded{
+			img: reg, small: small, index: first + i, decoded: img,
+		}
+	}
+}
+
+// thumbPixmap converts a thumbnail to an xgraphics.Image type and draws it
+// to an X pixmap.
+func thumbPixmap(X *xgbutil.XUtil, thumb image.Image) (*xgraphics.Image,
+	error) {
+
+	reg := xgraphics.NewConvert(X, thumb)
+
+	// Thumbnails are small enough that it's cheaper to always blend
+	// than to figure out if the image has an alpha channel.
+	// (They aren't blended again when the backdrop is changed at runtime.)
+	blendBackdrop(reg, flagBackdrop)
+
+	if err := reg.CreatePixmap(); err != nil {
+		return nil, err
+	}
+	reg.XDraw()
+	return reg, nil
+}
+
+// scaleDown returns a copy of img that fits inside a size x size square while
+// preserving its aspect ratio. Images that already fit are not enlarged.
+// Each destination pixel is the average of (at most 4x4) samples taken from
+// the corresponding box in the source image. Sampling is a lot faster than
+// averaging the entire box for big images, and it still looks fine at
+// thumbnail sizes.
+func scaleDown(img image.Image, size int) *image.RGBA {
+	src := img.Bounds()
+	sw, sh := src.Dx(), src.Dy()
+	dw, dh := sw, sh
+	if sw > size || sh > size {
+		if sw >= sh {
+			dw, dh = size, max(1, sh*size/sw)
+		} else {
+			dw, dh = max(1, sw*size/sh), size
+		}
+	}
+	return scaleTo(img, dw, dh)
+}
+
+// scaleTo returns a copy of img scaled down to dw x dh pixels, sampling the
+// source image just like scaleDown.
+func scaleTo(img image.Image, dw, dh int) *image.RGBA {
+	src := img.Bounds()
+	sw, sh := src.Dx(), src.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		sy0, sy1 := src.Min.Y+dy*sh/dh, src.Min.Y+(dy+1)*sh/dh
+		ystep := max(1, (sy1-sy0)/4)
+		for dx := 0; dx < dw; dx++ {
+			sx0, sx1 := src.Min.X+dx*sw/dw, src.Min.X+(dx+1)*sw/dw
+			xstep := max(1, (sx1-sx0)/4)
+
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < max(sy1, sy0+1); sy += ystep {
+				for sx := sx0; sx < max(sx1, sx0+1); sx += xstep {
+					sr, sg, sb, sa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+sr, g+sg, b+sb, a+sa
+					n++
+				}
+			}
+
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
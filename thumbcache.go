@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The thumbnail cache follows the freedesktop.org thumbnail specification:
+// http://specifications.freedesktop.org/thumbnail-spec/
+// Thumbnails are PNG files named after the MD5 sum of the original file's
+// URI, and they are kept in a directory that depends on their size. Each
+// thumbnail records the URI and modification time of the original file in
+// PNG text chunks, which is how we tell if a thumbnail is stale.
+// Since file managers use the same cache, imgv can reuse their thumbnails
+// (and vice versa).
+
+// thumbSizeLarge is the size of the thumbnails stored in the 'large'
+// directory. (The 'normal' directory stores thumbnails of size thumbSize.)
+const thumbSizeLarge = 256
+
+// uriPathChars are the characters that aren't escaped in the path of a URI.
+// (The unreserved characters of RFC 2396, "/", and the reserved characters
+// that are allowed in a path.)
+const uriPathChars = "abcdefghijklmnopqrstuvwxyz" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789" +
+	"-_.!~*'()" + "/:@&=+$,"
+
+// pngSignature is the first eight bytes of every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// thumbDir returns the directory containing thumbnails of the given size.
+// i.e., "$XDG_CACHE_HOME/thumbnails/normal".
+func thumbDir(size string) string {
+	cache := os.Getenv("XDG_CACHE_HOME")
+	if len(cache) == 0 {
+		cache = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return filepath.Join(cache, "thumbnails", size)
+}
+
+// thumbURI returns the URI that identifies the file fName in the thumbnail
+// cache. It is always an absolute "file://" URI.
+// The URI has to be escaped exactly like GLib's g_filename_to_uri escapes
+// it, since that's what file managers use: every byte is escaped except for
+// the characters that RFC 2396 allows in a path. (net/url escapes more.)
+func thumbURI(fName string) (string, error) {
+	abs, err := filepath.Abs(fName)
+	if err != nil {
+		return "", err
+	}
+	const hex = "0123456789ABCDEF"
+	uri := []byte("file://")
+	for i := 0; i < len(abs); i++ {
+		c := abs[i]
+		if c < 0x80 && strings.IndexByte(uriPathChars, c) > -1 {
+			uri = append(uri, c)
+		} else {
+			uri = append(uri, '%', hex[c>>4], hex[c&0xf])
+		}
+	}
+	return string(uri), nil
+}
+
+// thumbPath returns the file name of the thumbnail for the given URI.
+func thumbPath(size, uri string) string {
+	return filepath.Join(thumbDir(size),
+		fmt.Sprintf("%x.png", md5.Sum([]byte(uri))))
+}
+
+// cachedThumb looks for a thumbnail of the image file fName that isn't
+// stale. It first looks for a normal sized thumbnail, and then for a large
+// thumbnail (which is scaled down and saved as a normal thumbnail).
+// An error is returned if there is no valid thumbnail.
+func cachedThumb(fName string) (image.Image, error) {
+	uri, err := thumbURI(fName)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(fName)
+	if err != nil {
+		return nil, err
+	}
+	mtime := strconv.FormatInt(fi.ModTime().Unix(), 10)
+
+	if img, err := readThumb(thumbPath("normal", uri), uri, mtime); err == nil {
+		return img, nil
+	}
+	img, err := readThumb(thumbPath("large", uri), uri, mtime)
+	if err != nil {
+		return nil, err
+	}
+	normal := scaleDown(img, thumbSize)
+	if err := writeThumb(thumbPath("normal", uri), normal, uri,
+		mtime); err != nil {
+
+		lg("Could not save thumbnail of '%s': %s", fName, err)
+	}
+	return normal, nil
+}
+
+// cacheThumbs saves both a large and a normal thumbnail of img, which was
+// decoded from the file fName. The normal thumbnail is returned even if
+// saving fails, since saving is just an optimization.
+func cacheThumbs(fName string, img image.Image) *image.RGBA {
+	large := scaleDown(img, thumbSizeLarge)
+	normal := scaleDown(large, thumbSize)
+
+	uri, err := thumbURI(fName)
+	if err != nil {
+		lg("Could not save thumbnail of '%s': %s", fName, err)
+		return normal
+	}
+	fi, err := os.Stat(fName)
+	if err != nil {
+		lg("Could not save thumbnail of '%s': %s", fName, err)
+		return normal
+	}
+	mtime := strconv.FormatInt(fi.ModTime().Unix(), 10)
+
+	for _, thumb := range []struct {
+		size string
+		img  image.Image
+	}{{"large", large}, {"normal", normal}} {
+		err := writeThumb(thumbPath(thumb.size, uri), thumb.img, uri, mtime)
+		if err != nil {
+			lg("Could not save thumbnail of '%s': %s", fName, err)
+		}
+	}
+	return normal
+}
+
+// readThumb decodes the thumbnail in the file tName and makes sure that it
+// belongs to the file with the given URI and modification time.
+func readThumb(tName, uri, mtime string) (image.Image, error) {
+	data, err := os.ReadFile(tName)
+	if err != nil {
+		return nil, err
+	}
+	text, err := pngText(data)
+	if err != nil {
+		return nil, err
+	}
+	if text["Thumb::URI"] != uri {
+		return nil, fmt.Errorf("Thumbnail '%s' does not belong to '%s'.",
+			tName, uri)
+	}
+	if text["Thumb::MTime"] != mtime {
+		return nil, fmt.Errorf("Thumbnail '%s' is stale.", tName)
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// writeThumb encodes img as a PNG file with the Thumb::URI and Thumb::MTime
+// text chunks set. The file is written atomically (by writing to a temporary
+// file and renaming it), as required by the thumbnail specification.
+func writeThumb(tName string, img image.Image, uri, mtime string) error {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+	data, err := pngAddText(buf.Bytes(), [][2]string{
+		{"Thumb::URI", uri},
+		{"Thumb::MTime", mtime},
+		{"Software", "imgv"},
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(tName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "imgv-*.png")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), tName)
+}
+
+// pngText returns all of the keyword/text pairs stored in the tEXt chunks of
+// the PNG data.
+func pngText(data []byte) (map[string]string, error) {
+	text := make(map[string]string)
+	err := pngChunks(data, func(typ string, chunk []byte) {
+		if typ != "tEXt" {
+			return
+		}
+		if i := bytes.IndexByte(chunk, 0); i > -1 {
+			text[string(chunk[:i])] = string(chunk[i+1:])
+		}
+	})
+	return text, err
+}
+
+// pngAddText inserts a tEXt chunk for each keyword/text pair right after
+// the IHDR chunk (which is always first) of the PNG data.
+func pngAddText(data []byte, pairs [][2]string) ([]byte, error) {
+	if len(data) < len(pngSignature)+8 {
+		return nil, errors.New("PNG data is too short.")
+	}
+	ihdrEnd := len(pngSignature) + 12 +
+		int(binary.BigEndian.Uint32(data[len(pngSignature):]))
+	if ihdrEnd > len(data) {
+		return nil, errors.New("PNG data is too short.")
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write(data[:ihdrEnd])
+	for _, pair := range pairs {
+		writeChunk(buf, "tEXt", []byte(pair[0]+"\x00"+pair[1]))
+	}
+	buf.Write(data[ihdrEnd:])
+	return buf.Bytes(), nil
+}
+
+// pngChunks calls each for every chunk in the PNG data, in order, with the
+// chunk type and the chunk data.
+func pngChunks(data []byte, each func(typ string, chunk []byte)) error {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return errors.New("Not a PNG file.")
+	}
+	data = data[len(pngSignature):]
+	for len(data) >= 12 {
+		length := int(binary.BigEndian.Uint32(data))
+		if length < 0 || 12+length > len(data) {
+			return io.ErrUnexpectedEOF
+		}
+		typ := string(data[4:8])
+		each(typ, data[8:8+length])
+		if typ == "IEND" {
+			return nil
+		}
+		data = data[12+length:]
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// writeChunk writes a single PNG chunk: its length, type, data and the
+// CRC of the type and data.
+func writeChunk(w io.Writer, typ string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	w.Write(header[:])
+	w.Write(data)
+	w.Write(footer[:])
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+)
+
+// testPNG returns a small PNG image encoded by image/png.
+func testPNG(t *testing.T) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.NRGBA{R: 0xff, A: 0xff})
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPNGTextRoundTrip(t *testing.T) {
+	tests := [][][2]string{
+		nil,
+		{{"Thumb::URI", "file:///tmp/a.png"}},
+		{
+			{"Thumb::URI", "file:///tmp/a%20b.png"},
+			{"Thumb::MTime", "1234567890"},
+			{"Software", "imgv"},
+		},
+		{{"Empty", ""}},
+	}
+	for _, pairs := range tests {
+		data, err := pngAddText(testPNG(t), pairs)
+		if err != nil {
+			t.Errorf("pngAddText(%v): %s", pairs, err)
+			continue
+		}
+
+		// The image itself must be unchanged.
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("png.Decode after pngAddText(%v): %s", pairs, err)
+			continue
+		}
+		if img.Bounds() != image.Rect(0, 0, 3, 2) {
+			t.Errorf("pngAddText(%v): bounds are %s", pairs, img.Bounds())
+		}
+		if _, _, _, a := img.At(1, 1).RGBA(); a != 0xffff {
+			t.Errorf("pngAddText(%v): pixel (1, 1) changed", pairs)
+		}
+
+		text, err := pngText(data)
+		if err != nil {
+			t.Errorf("pngText after pngAddText(%v): %s", pairs, err)
+			continue
+		}
+		if len(text) != len(pairs) {
+			t.Errorf("pngText after pngAddText(%v): got %v", pairs, text)
+		}
+		for _, pair := range pairs {
+			if text[pair[0]] != pair[1] {
+				t.Errorf("pngText after pngAddText(%v): %s is '%s'",
+					pairs, pair[0], text[pair[0]])
+			}
+		}
+	}
+}
+
+func TestPNGInvalid(t *testing.T) {
+	valid, err := pngAddText(testPNG(t), [][2]string{{"Key", "value"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A chunk whose length is bigger than the rest of the data.
+	huge := append([]byte{}, valid...)
+	huge[len(pngSignature)+25] = 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a PNG", []byte("GIF89a, but longer than a signature")},
+		{"signature only", pngSignature},
+		{"truncated chunk header", valid[:len(pngSignature)+6]},
+		{"truncated chunk", valid[:len(pngSignature)+20]},
+		{"no IEND", valid[:len(valid)-12]},
+		{"chunk too long", huge},
+	}
+	for _, test := range tests {
+		if _, err := pngText(test.data); err == nil {
+			t.Errorf("pngText(%s): expected an error", test.name)
+		}
+	}
+
+	for _, test := range tests[:5] {
+		pairs := [][2]string{{"Key", "value"}}
+		if _, err := pngAddText(test.data, pairs); err == nil {
+			t.Errorf("pngAddText(%s): expected an error", test.name)
+		}
+	}
+}
+
+func TestReadThumb(t *testing.T) {
+	tName := filepath.Join(t.TempDir(), "thumb.png")
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	uri := "file:///tmp/a.png"
+	if err := writeThumb(tName, img, uri, "100"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uri, mtime string
+		ok         bool
+	}{
+		{uri, "100", true},
+		{uri, "101", false},
+		{uri, "", false},
+		{"file:///tmp/b.png", "100", false},
+	}
+	for _, test := range tests {
+		thumb, err := readThumb(tName, test.uri, test.mtime)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("readThumb(%s, %s): %s", test.uri, test.mtime, err)
+		case test.ok && thumb.Bounds() != img.Bounds():
+			t.Errorf("readThumb(%s, %s): bounds are %s",
+				test.uri, test.mtime, thumb.Bounds())
+		case !test.ok && err == nil:
+			t.Errorf("readThumb(%s, %s): expected an error",
+				test.uri, test.mtime)
+		}
+	}
+}
+
+func TestThumbURI(t *testing.T) {
+	tests := []struct {
+		fName, uri string
+	}{
+		{"/tmp/a.png", "file:///tmp/a.png"},
+		{"/tmp/a b.png", "file:///tmp/a%20b.png"},
+		{"/tmp/(1)'!*~.png", "file:///tmp/(1)'!*~.png"},
+		{"/tmp/a:b@c&d=e+f$g,h.png", "file:///tmp/a:b@c&d=e+f$g,h.png"},
+		{"/tmp/#%;?.png", "file:///tmp/%23%25%3B%3F.png"},
+		{"/tmp/é.png", "file:///tmp/%C3%A9.png"},
+		{"/tmp/../tmp/./a.png", "file:///tmp/a.png"},
+	}
+	for _, test := range tests {
+		uri, err := thumbURI(test.fName)
+		if err != nil {
+			t.Errorf("thumbURI(%s): %s", test.fName, err)
+		} else if uri != test.uri {
+			t.Errorf("thumbURI(%s) = %s, want %s", test.fName, uri, test.uri)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"image"
+	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/xgbutil/xgraphics"
@@ -33,6 +35,37 @@ func basename(fName string) string {
 	return fName
 }
 
+// latin1 converts a UTF-8 string to a Latin-1 string, which is what core X
+// fonts expect. Characters that aren't in Latin-1 are replaced with '?'.
+func latin1(s string) string {
+	bs := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			r = '?'
+		}
+		bs = append(bs, byte(r))
+	}
+	return string(bs)
+}
+
+// cycle returns the value after cur in list, wrapping around at the end.
+// The first value is returned if cur isn't in list.
+func cycle(list []string, cur string) string {
+	for i, s := range list {
+		if s == cur {
+			return list[(i+1)%len(list)]
+		}
+	}
+	return list[0]
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -46,3 +79,32 @@ func max(a, b int) int {
 	}
 	return b
 }
+
+// colorFlag is a command line flag that holds a color given as "#rrggbb".
+type colorFlag uint32
+
+func (c *colorFlag) String() string {
+	return fmt.Sprintf("#%06x", uint32(*c))
+}
+
+func (c *colorFlag) Set(s string) error {
+	hex := strings.TrimPrefix(s, "#")
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return fmt.Errorf("'%s' is not a color in #rrggbb format", s)
+	}
+	*c = colorFlag(n)
+	return nil
+}
+
+// pixel returns the color in the 0xRRGGBB format that X expects.
+func (c colorFlag) pixel() uint32 {
+	return uint32(c)
+}
+
+// bgra returns the color as an opaque xgraphics.BGRA value.
+func (c colorFlag) bgra() xgraphics.BGRA {
+	return xgraphics.BGRA{
+		B: uint8(c), G: uint8(c >> 8), R: uint8(c >> 16), A: 0xff,
+	}
+}
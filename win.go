@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"image"
+	"strings"
 
 	"github.com/BurntSushi/xgb/xproto"
 
@@ -13,17 +14,66 @@ import (
 	"github.com/BurntSushi/xgbutil/mousebind"
 	"github.com/BurntSushi/xgbutil/xevent"
 	"github.com/BurntSushi/xgbutil/xgraphics"
+	"github.com/BurntSushi/xgbutil/xprop"
+	"github.com/BurntSushi/xgbutil/xrect"
 	"github.com/BurntSushi/xgbutil/xwindow"
 )
 
+// eventMask is the set of events that the window always listens to.
+// (Pointer motion is only listened to when the pixel inspector needs it.)
+const eventMask = xproto.EventMaskStructureNotify | xproto.EventMaskExposure |
+	xproto.EventMaskButtonPress | xproto.EventMaskButtonRelease |
+	xproto.EventMaskKeyPress | xproto.EventMaskKeyRelease |
+	xproto.EventMaskPropertyChange
+
+// textPad is the amount of space (in pixels) between text and the edges of
+// the box it is drawn in.
+const textPad = 6
+
 // keyb represents a value in the keybinding list. Namely, it contains the
-// function to run when a particular key sequence has been pressed, the
-// key sequence to bind to, and a quick description of what the keybinding
-// actually does.
+// key sequence to bind to and the name of the action to run when that key
+// sequence has been pressed.
 type keyb struct {
 	key    string
-	desc   string
-	action func(w *window)
+	action string
+
+	// line is the line in the configuration file that this keybinding came
+	// from, or 0 if it is a default keybinding.
+	line int
+}
+
+// mouseb represents a value in the mouse binding list. It is just like keyb,
+// except that it binds a mouse button (i.e., "1" or "shift-4") instead of a
+// key sequence. Buttons prefixed with "double-" are double clicks.
+// The special action "pan" pans the image while the button is held down.
+type mouseb struct {
+	button string
+	action string
+	line   int
+}
+
+// doubleClickTime is the most time (in milliseconds) that can pass between
+// two clicks for them to count as a double click.
+const doubleClickTime = 400
+
+// action represents a value in the list of actions that can be bound to keys.
+// It contains the name of the action, a quick description of what the action
+// does, and the function to run when the action is invoked.
+type action struct {
+	name string
+	desc string
+	run  func(w *window)
+}
+
+// findAction returns the action with the given name, or nil if there is no
+// such action.
+func findAction(name string) *action {
+	for i := range actions {
+		if actions[i].name == name {
+			return &actions[i]
+		}
+	}
+	return nil
 }
 
 // window embeds an xwindow.Window value and all available channels used to
@@ -34,12 +84,53 @@ type keyb struct {
 type window struct {
 	*xwindow.Window
 	chans chans
+
+	// gc is the graphics context used to draw anything that isn't an image.
+	// (i.e., the selection outline in the thumbnail grid.)
+	gc xproto.Gcontext
+
+	// textGC is the graphics context used to draw text. It draws white text
+	// on a black background with the core X font "fixed". (Which every X
+	// server has.)
+	textGC xproto.Gcontext
+
+	// The width of each character (the font is monospaced), the distance
+	// from the top of a line to its baseline and the height of a line of
+	// text drawn with textGC.
+	charWidth, ascent, lineHeight int
+
+	// stripHeight is the height of the filmstrip at the bottom of the
+	// window, or 0 if it isn't shown. It is set by the canvas.
+	stripHeight int
+
+	// clip is the text the window offers when it owns the clipboard.
+	clip clipboard
+
+	// full records whether the window is fullscreen. (See isFullscreen.)
+	full fullState
+
+	// xinerama is true when the Xinerama extension can be used to find
+	// the geometry of each monitor.
+	xinerama bool
+
+	// restoreGeom is the geometry to restore when leaving fullscreen mode,
+	// if the window manager couldn't make the window fullscreen for us.
+	restoreGeom xrect.Rect
+
+	// shownIndex and shownFile are the index and file name of the image
+	// last published in the window's properties. (See currentSet.) They are
+	// only touched by the canvas goroutine.
+	shownIndex int
+	shownFile  string
+
+	// prompt is the line of text being typed into, if any. (See prompt.go.)
+	prompt prompt
 }
 
 // newWndow creates a new window and dies on failure.
 // This includes mapping the window but not setting up the event handlers.
 // (The event handlers require the channels, and we don't create the channels
-// until all images have been decoded. But we want to show the window to the
+// until all images have been opened. But we want to show the window to the
 // user before that task is complete.)
 func newWindow(X *xgbutil.XUtil) *window {
 	xwin, err := xwindow.Generate(X)
@@ -61,12 +152,30 @@ func (w *window) create() {
 	keybind.Initialize(w.X)
 	mousebind.Initialize(w.X)
 
-	err := w.CreateChecked(w.X.RootWin(), 0, 0, flagWidth, flagHeight,
-		xproto.CwBackPixel, 0xffffff)
+	w.initMonitors()
+	geom, placed := w.placement()
+	x, y := 0, 0
+	if placed {
+		x, y = geom.X(), geom.Y()
+	}
+	err := w.CreateChecked(w.X.RootWin(), x, y, geom.Width(), geom.Height(),
+		xproto.CwBackPixel, flagBackground.pixel())
 	if err != nil {
 		errLg.Fatalf("Could not create window: %s", err)
 	}
 
+	// Create graphics contexts for drawing outlines, boxes and text.
+	if w.gc, err = xproto.NewGcontextId(w.X.Conn()); err != nil {
+		errLg.Fatalf("Could not create graphics context: %s", err)
+	}
+	err = xproto.CreateGCChecked(w.X.Conn(), w.gc, xproto.Drawable(w.Id),
+		xproto.GcForeground|xproto.GcLineWidth|xproto.GcGraphicsExposures,
+		[]uint32{0x3399ff, 3, 0}).Check()
+	if err != nil {
+		errLg.Fatalf("Could not create graphics context: %s", err)
+	}
+	w.createTextGC()
+
 	// Make the window close gracefully using the WM_DELETE_WINDOW protocol.
 	w.WMGracefulClose(func(w *xwindow.Window) {
 		xevent.Detach(w.X, w.Id)
@@ -84,55 +193,216 @@ func (w *window) create() {
 		lg("Could not set WM_STATE: %s", err)
 	}
 
+	// Ask the window manager to leave the window where --monitor put it.
+	if placed {
+		err = icccm.WmNormalHintsSet(w.X, w.Id, &icccm.NormalHints{
+			Flags: icccm.SizeHintUSPosition | icccm.SizeHintUSSize,
+			X:     x, Y: y,
+			Width: uint(geom.Width()), Height: uint(geom.Height()),
+		})
+		if err != nil { // not a fatal error
+			lg("Could not set WM_NORMAL_HINTS: %s", err)
+		}
+	}
+
 	// _NET_WM_STATE = _NET_WM_STATE_NORMAL
-	ewmh.WmStateSet(w.X, w.Id, []string{"_NET_WM_STATE_NORMAL"})
+	// (Or _NET_WM_STATE_FULLSCREEN, which the window manager will honor when
+	// it maps the window.)
+	if flagFullscreen && w.ewmhFullscreen() {
+		ewmh.WmStateSet(w.X, w.Id, []string{"_NET_WM_STATE_FULLSCREEN"})
+		w.fullscreenSet(true)
+	} else {
+		ewmh.WmStateSet(w.X, w.Id, []string{"_NET_WM_STATE_NORMAL"})
+	}
 
 	// Set the name to something.
 	w.nameSet("Decoding all images...")
+	w.classSet()
 
 	w.Map()
+	if flagFullscreen && !w.isFullscreen() {
+		w.fakeFullscreen(true)
+	}
+}
+
+// createTextGC opens the "fixed" font and creates a graphics context to
+// draw text with. It dies on failure.
+func (w *window) createTextGC() {
+	font, err := xproto.NewFontId(w.X.Conn())
+	if err != nil {
+		errLg.Fatalf("Could not open font: %s", err)
+	}
+	err = xproto.OpenFontChecked(w.X.Conn(), font,
+		uint16(len("fixed")), "fixed").Check()
+	if err != nil {
+		errLg.Fatalf("Could not open font: %s", err)
+	}
+
+	finfo, err := xproto.QueryFont(w.X.Conn(),
+		xproto.Fontable(font)).Reply()
+	if err != nil {
+		errLg.Fatalf("Could not query font: %s", err)
+	}
+	w.charWidth = int(finfo.MaxBounds.CharacterWidth)
+	w.ascent = int(finfo.FontAscent)
+	w.lineHeight = int(finfo.FontAscent + finfo.FontDescent)
+
+	if w.textGC, err = xproto.NewGcontextId(w.X.Conn()); err != nil {
+		errLg.Fatalf("Could not create graphics context: %s", err)
+	}
+	err = xproto.CreateGCChecked(w.X.Conn(), w.textGC,
+		xproto.Drawable(w.Id),
+		xproto.GcForeground|xproto.GcBackground|xproto.GcFont|
+			xproto.GcGraphicsExposures,
+		[]uint32{0xffffff, 0x000000, uint32(font), 0}).Check()
+	if err != nil {
+		errLg.Fatalf("Could not create graphics context: %s", err)
+	}
 }
 
 // stepLeft moves the origin of the image to the left.
+// (Or moves the selection to the left in the thumbnail grid.)
 func (w *window) stepLeft() {
-	w.chans.drawChan <- func(origin image.Point) image.Point {
-		return image.Point{origin.X - flagStepIncrement, origin.Y}
-	}
+	w.chans.stepChan <- image.Point{-1, 0}
 }
 
 // stepRight moves the origin of the image to the right.
+// (Or moves the selection to the right in the thumbnail grid.)
 func (w *window) stepRight() {
-	w.chans.drawChan <- func(origin image.Point) image.Point {
-		return image.Point{origin.X + flagStepIncrement, origin.Y}
-	}
+	w.chans.stepChan <- image.Point{1, 0}
 }
 
 // stepUp moves the origin of the image down (this would be up, but X origins
 // are in the top-left corner).
+// (Or moves the selection up in the thumbnail grid.)
 func (w *window) stepUp() {
-	w.chans.drawChan <- func(origin image.Point) image.Point {
-		return image.Point{origin.X, origin.Y - flagStepIncrement}
-	}
+	w.chans.stepChan <- image.Point{0, -1}
 }
 
 // stepDown moves the origin of the image up (this would be down, but X origins
 // are in the top-left corner).
+// (Or moves the selection down in the thumbnail grid.)
 func (w *window) stepDown() {
-	w.chans.drawChan <- func(origin image.Point) image.Point {
-		return image.Point{origin.X, origin.Y + flagStepIncrement}
-	}
+	w.chans.stepChan <- image.Point{0, 1}
 }
 
 // paint uses the xgbutil/xgraphics package to copy the area corresponding
 // to ximg in its pixmap to the window. It will also issue a clear request
 // before hand to try and avoid artifacts.
 func (w *window) paint(ximg *xgraphics.Image) {
-	dst := vpCenter(ximg, w.Geom.Width(), w.Geom.Height())
+	vw, vh := w.viewport()
+	dst := vpCenter(ximg, vw, vh)
 	// UUU Commenting this out avoids flickering, and I see no artifacts!
 	// w.ClearAll() 
 	ximg.XExpPaint(w.Id, dst.X, dst.Y)
 }
 
+// viewport returns the width and height of the part of the window that
+// images are painted to. This is the whole window minus the filmstrip.
+func (w *window) viewport() (int, int) {
+	return w.Geom.Width(), max(1, w.Geom.Height()-w.stripHeight)
+}
+
+// outline draws the border of the rectangle r (in window coordinates) using
+// the window's graphics context.
+func (w *window) outline(r image.Rectangle) {
+	xproto.ChangeGC(w.X.Conn(), w.gc,
+		xproto.GcForeground|xproto.GcLineWidth, []uint32{0x3399ff, 3})
+	xproto.PolyRectangle(w.X.Conn(), xproto.Drawable(w.Id), w.gc,
+		[]xproto.Rectangle{{
+			X:      int16(r.Min.X),
+			Y:      int16(r.Min.Y),
+			Width:  uint16(r.Dx() - 1),
+			Height: uint16(r.Dy() - 1),
+		}})
+}
+
+// fill paints the rectangle r (in window coordinates) with the color clr.
+// (Where clr is in 0xRRGGBB format.)
+func (w *window) fill(r image.Rectangle, clr uint32) {
+	xproto.ChangeGC(w.X.Conn(), w.gc, xproto.GcForeground, []uint32{clr})
+	xproto.PolyFillRectangle(w.X.Conn(), xproto.Drawable(w.Id), w.gc,
+		[]xproto.Rectangle{{
+			X:      int16(r.Min.X),
+			Y:      int16(r.Min.Y),
+			Width:  uint16(r.Dx()),
+			Height: uint16(r.Dy()),
+		}})
+}
+
+// clearAround clears the parts of the rectangle r (in window coordinates)
+// that aren't covered by inner. All of r is cleared if inner is empty.
+func (w *window) clearAround(r, inner image.Rectangle) {
+	inner = inner.Intersect(r)
+	if inner.Empty() {
+		inner = image.Rectangle{r.Min, r.Min}
+	}
+	for _, c := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, inner.Min.Y),
+		image.Rect(r.Min.X, inner.Max.Y, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, inner.Min.Y, inner.Min.X, inner.Max.Y),
+		image.Rect(inner.Max.X, inner.Min.Y, r.Max.X, inner.Max.Y),
+	} {
+		// A zero width or height would clear to the edge of the window.
+		if !c.Empty() {
+			w.Clear(c.Min.X, c.Min.Y, c.Dx(), c.Dy())
+		}
+	}
+}
+
+// polyline draws lines connecting each of the points (in window coordinates)
+// with the color clr. (Where clr is in 0xRRGGBB format.)
+func (w *window) polyline(points []image.Point, clr uint32) {
+	xpoints := make([]xproto.Point, len(points))
+	for i, pt := range points {
+		xpoints[i] = xproto.Point{X: int16(pt.X), Y: int16(pt.Y)}
+	}
+	xproto.ChangeGC(w.X.Conn(), w.gc,
+		xproto.GcForeground|xproto.GcLineWidth, []uint32{clr, 1})
+	xproto.PolyLine(w.X.Conn(), xproto.CoordModeOrigin,
+		xproto.Drawable(w.Id), w.gc, xpoints)
+}
+
+// textSize returns the width and height of the box that text would draw
+// the given lines in.
+func (w *window) textSize(lines []string) (int, int) {
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len(latin1(line)))
+	}
+	return longest*w.charWidth + 2*textPad,
+		len(lines)*w.lineHeight + 2*textPad
+}
+
+// text draws each of the lines in a black box whose top-left corner is at
+// (x, y) in window coordinates. The text is white, so that it is readable
+// on top of any image. The box that was drawn is returned.
+func (w *window) text(x, y int, lines []string) image.Rectangle {
+	width, height := w.textSize(lines)
+	box := image.Rect(x, y, x+width, y+height)
+	w.fill(box, 0x000000)
+
+	for i, line := range lines {
+		line = latin1(line)
+		if len(line) > 255 { // ImageText8 can only draw 255 characters.
+			line = line[:255]
+		}
+		xproto.ImageText8(w.X.Conn(), byte(len(line)),
+			xproto.Drawable(w.Id), w.textGC, int16(x+textPad),
+			int16(y+textPad+i*w.lineHeight+w.ascent), line)
+	}
+	return box
+}
+
+// trackPointer starts or stops listening to pointer motion events.
+func (w *window) trackPointer(track bool) {
+	if track {
+		w.Listen(eventMask | xproto.EventMaskPointerMotion)
+	} else {
+		w.Listen(eventMask)
+	}
+}
+
 // nameSet will set the name of the window and emit a benign message to
 // verbose output if it fails.
 func (w *window) nameSet(name string) {
@@ -146,15 +416,19 @@ func (w *window) nameSet(name string) {
 // setupEventHandlers attaches the canvas' channels to the window and
 // sets the appropriate callbacks to some events:
 // ConfigureNotify events will cause the window to update its state of geometry.
+// PropertyNotify events to notice when the window becomes fullscreen.
 // Expose events will cause the window to repaint the current image.
-// Button events to allow panning.
-// Key events to perform various tasks when certain keys are pressed. Should
-// these be configurable? Meh.
+// MotionNotify events to track the pointer for the pixel inspector.
+// SelectionRequest events to hand out the contents of the clipboard.
+// ClientMessage events to run commands sent by other clients.
+// Button events to allow panning and to run the actions bound to mouse
+// buttons. (See the mousebinds list.)
+// Key events to perform various tasks when certain keys are pressed. (See the
+// keybinds list, which may be changed by the configuration file.) While the
+// prompt is open, key events edit its text instead.
 func (w *window) setupEventHandlers(chans chans) {
 	w.chans = chans
-	w.Listen(xproto.EventMaskStructureNotify | xproto.EventMaskExposure |
-		xproto.EventMaskButtonPress | xproto.EventMaskButtonRelease |
-		xproto.EventMaskKeyPress)
+	w.Listen(eventMask)
 
 	// Get the current geometry in case we don't get a ConfigureNotify event
 	// (or have already missed it).
@@ -170,11 +444,26 @@ func (w *window) setupEventHandlers(chans chans) {
 		}
 	}()
 
-	// Keep a state of window geometry.
+	// Keep a state of window geometry. The canvas is told whenever the size
+	// changes, since the image has to be centered again.
 	xevent.ConfigureNotifyFun(
 		func(X *xgbutil.XUtil, ev xevent.ConfigureNotifyEvent) {
-			w.Geom.WidthSet(int(ev.Width))
-			w.Geom.HeightSet(int(ev.Height))
+			width, height := int(ev.Width), int(ev.Height)
+			if width == w.Geom.Width() && height == w.Geom.Height() {
+				return
+			}
+			w.Geom.WidthSet(width)
+			w.Geom.HeightSet(height)
+			w.chans.geomChan <- struct{}{}
+		}).Connect(w.X, w.Id)
+
+	// Keep track of whether the window manager has made us fullscreen.
+	xevent.PropertyNotifyFun(
+		func(X *xgbutil.XUtil, ev xevent.PropertyNotifyEvent) {
+			name, err := xprop.AtomName(w.X, ev.Atom)
+			if err == nil && name == "_NET_WM_STATE" {
+				w.stateChanged()
+			}
 		}).Connect(w.X, w.Id)
 
 	// Repaint the window on expose events.
@@ -185,29 +474,151 @@ func (w *window) setupEventHandlers(chans chans) {
 			}
 		}).Connect(w.X, w.Id)
 
-	// Setup a drag handler to allow panning.
-	mousebind.Drag(w.X, w.Id, w.Id, "1", false,
-		func(X *xgbutil.XUtil, rx, ry, ex, ey int) (bool, xproto.Cursor) {
-			w.chans.panStartChan <- image.Point{ex, ey}
-			return true, 0
-		},
-		func(X *xgbutil.XUtil, rx, ry, ex, ey int) {
-			w.chans.panStepChan <- image.Point{ex, ey}
-		},
-		func(X *xgbutil.XUtil, rx, ry, ex, ey int) {
-			w.chans.panEndChan <- image.Point{ex, ey}
-		})
+	// Tell the canvas where the pointer is. (These events are only sent
+	// when the pixel inspector is active. See trackPointer.)
+	xevent.MotionNotifyFun(
+		func(X *xgbutil.XUtil, ev xevent.MotionNotifyEvent) {
+			w.chans.pointerChan <- image.Point{int(ev.EventX), int(ev.EventY)}
+		}).Connect(w.X, w.Id)
+
+	// Give other clients the text copied to the clipboard.
+	xevent.SelectionRequestFun(w.selectionRequest).Connect(w.X, w.Id)
+
+	// Run the commands that other clients send. (See message.go.)
+	xevent.ClientMessageFun(w.clientMessage).Connect(w.X, w.Id)
+
+	// Clicks of the first button that choose from the context menu or open
+	// an image are handled apart from whatever action the button is bound
+	// to. This is connected first, so that the canvas sees a click before
+	// the action bound to it.
+	xevent.ButtonPressFun(
+		func(X *xgbutil.XUtil, ev xevent.ButtonPressEvent) {
+			if ev.Detail == 1 && !w.promptOpen() {
+				pt := image.Point{int(ev.EventX), int(ev.EventY)}
+				w.chans.clickChan <- pt
+			}
+		}).Connect(w.X, w.Id)
+
+	// Set up the mouse bindings. (Including panning.)
+	for _, mouseb := range mousebinds {
+		w.mouseBind(mouseb)
+	}
+
+	// Let the prompt see every key press before the keybindings do, so that
+	// they can ignore the key presses that it handles.
+	xevent.KeyPressFun(w.promptKey).Connect(w.X, w.Id)
 
 	// Set up a map of keybindings to avoid a lot of boiler plate.
-	// for keystring, fun := range kbs { 
 	for _, keyb := range keybinds {
 		keyb := keyb
+		if keyb.action == "flip-compare" {
+			w.holdBind(keyb)
+			continue
+		}
+		act := findAction(keyb.action)
 		err := keybind.KeyPressFun(
 			func(X *xgbutil.XUtil, ev xevent.KeyPressEvent) {
-				keyb.action(w)
+				if !w.promptHandled(ev) {
+					act.run(w)
+				}
 			}).Connect(w.X, w.Id, keyb.key, false)
 		if err != nil {
-			errLg.Println(err)
+			bindError(keyb.line, "key", keyb.key, err)
 		}
 	}
 }
+
+// holdBind connects a key binding of the flip-compare action, which shows
+// image B in the flicker comparison mode while the key is held down, and
+// image A when it's released.
+// When a key auto-repeats, X sends a release and a press with the same time
+// for each repeat. Such a release is ignored if the press is already queued.
+func (w *window) holdBind(keyb keyb) {
+	err := keybind.KeyPressFun(
+		func(X *xgbutil.XUtil, ev xevent.KeyPressEvent) {
+			if !w.promptHandled(ev) {
+				w.chans.holdChan <- true
+			}
+		}).Connect(w.X, w.Id, keyb.key, false)
+	if err != nil {
+		bindError(keyb.line, "key", keyb.key, err)
+		return
+	}
+	keybind.KeyReleaseFun(
+		func(X *xgbutil.XUtil, ev xevent.KeyReleaseEvent) {
+			for _, queued := range xevent.Peek(X) {
+				press, ok := queued.Event.(xproto.KeyPressEvent)
+				if ok && press.Detail == ev.Detail && press.Time == ev.Time {
+					return
+				}
+			}
+			w.chans.holdChan <- false
+		}).Connect(w.X, w.Id, keyb.key, false)
+}
+
+// mouseBind connects a single mouse binding to the window. Mouse bindings
+// are ignored while the prompt is open. (See promptOpen.)
+func (w *window) mouseBind(mouseb mouseb) {
+	button := strings.TrimPrefix(mouseb.button, "double-")
+	if mouseb.action == "pan" {
+		// Setup a drag handler to allow panning.
+		mousebind.Drag(w.X, w.Id, w.Id, button, false,
+			func(X *xgbutil.XUtil, rx, ry, ex, ey int) (bool,
+				xproto.Cursor) {
+
+				if w.promptOpen() {
+					return false, 0
+				}
+				w.chans.panStartChan <- image.Point{ex, ey}
+				return true, 0
+			},
+			func(X *xgbutil.XUtil, rx, ry, ex, ey int) {
+				w.chans.panStepChan <- image.Point{ex, ey}
+			},
+			func(X *xgbutil.XUtil, rx, ry, ex, ey int) {
+				w.chans.panEndChan <- image.Point{ex, ey}
+			})
+		return
+	}
+
+	act := findAction(mouseb.action)
+	double := button != mouseb.button
+	var last xproto.Timestamp
+	err := mousebind.ButtonPressFun(
+		func(X *xgbutil.XUtil, ev xevent.ButtonPressEvent) {
+			if w.promptOpen() {
+				return
+			} else if !double {
+				act.run(w)
+			} else if last != 0 && ev.Time-last <= doubleClickTime {
+				last = 0
+				w.chans.doubleChan <- act
+			} else {
+				last = ev.Time
+			}
+		}).Connect(w.X, w.Id, button, false, false)
+	if err != nil {
+		bindError(mouseb.line, "mouse button", mouseb.button, err)
+	}
+}
+
+// bindError reports a key sequence or mouse button that couldn't be bound.
+// If the binding came from the configuration file, its line is included.
+func bindError(line int, what, binding string, err error) {
+	if line > 0 {
+		errLg.Printf("%s:%d: Invalid %s '%s': %s",
+			flagConfig, line, what, binding, err)
+	} else {
+		errLg.Printf("Invalid %s '%s': %s", what, binding, err)
+	}
+}
+
+// openMenu opens the context menu at the current position of the pointer.
+func (w *window) openMenu() {
+	reply, err := xproto.QueryPointer(w.X.Conn(), w.Id).Reply()
+	if err != nil {
+		errLg.Printf("Could not find the pointer: %s", err)
+		return
+	}
+	w.chans.menuChan <- image.Point{int(reply.WinX), int(reply.WinY)}
+}